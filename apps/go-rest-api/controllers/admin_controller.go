@@ -0,0 +1,365 @@
+package controllers
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// auditEventQuery applies the audit log filters in the query string: action, actorId,
+// targetId, ipAddress, and the from/to time range in RFC 3339
+func auditEventQuery(c *fiber.Ctx, db *gorm.DB) (*gorm.DB, validators.Errors) {
+	errs := validators.Errors{}
+	query := db.Model(&models.AuditEvent{})
+
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action = ?", action)
+	}
+	for param, column := range map[string]string{"actorId": "actor_id", "targetId": "target_id"} {
+		if value := c.Query(param); value != "" {
+			id, err := uuid.Parse(value)
+			if err != nil {
+				errs.Add(param, param+" must be a UUID")
+				continue
+			}
+			query = query.Where(column+" = ?", id)
+		}
+	}
+	if ipAddress := c.Query("ipAddress"); ipAddress != "" {
+		query = query.Where("ip_address = ?", ipAddress)
+	}
+	for param, operator := range map[string]string{"from": ">=", "to": "<"} {
+		if value := c.Query(param); value != "" {
+			at, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				errs.Add(param, param+" must be an RFC 3339 timestamp")
+				continue
+			}
+			query = query.Where("created_at "+operator+" ?", at)
+		}
+	}
+
+	return query, errs
+}
+
+const (
+	impersonationDefaultTTL = 30 * time.Minute
+	impersonationMaxTTL     = time.Hour
+)
+
+func RegisterAdminRoutes(group fiber.Router, db *gorm.DB) {
+	// POST /admin/lockouts/unlock
+	group.Post("/lockouts/unlock", middlewares.RequirePermission(models.PermissionLockoutsUnlock), func(c *fiber.Ctx) error {
+		// Define the form values
+		type UnlockFormValues struct {
+			Email     string `json:"email"`
+			IPAddress string `json:"ipAddress"`
+		}
+
+		// Parse the form values
+		var input UnlockFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		if input.Email == "" && input.IPAddress == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "email or ipAddress is required"})
+		}
+
+		// Initialize the login limiter
+		limiter := services.GetLoginLimiter()
+		if limiter == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "login limiter not initialized"})
+		}
+
+		// Clear the lockouts
+		if input.Email != "" {
+			if err := limiter.Reset(c.Context(), services.LoginEmailKey(input.Email)); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not unlock account"})
+			}
+		}
+		if input.IPAddress != "" {
+			if err := limiter.Reset(c.Context(), services.LoginIPKey(input.IPAddress)); err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not unlock address"})
+			}
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully removed lockout",
+		})
+	})
+
+	// GET /admin/roles
+	group.Get("/roles", middlewares.RequirePermission(models.PermissionRolesManage), func(c *fiber.Ctx) error {
+		// Retrieve all roles
+		var roles []models.Role
+		if err := db.Order("name ASC").Find(&roles).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve roles"})
+		}
+
+		// Return the list of roles
+		return c.Status(fiber.StatusOK).JSON(roles)
+	})
+
+	// POST /admin/users/:id/roles
+	group.Post("/users/:id/roles", middlewares.RequirePermission(models.PermissionRolesManage), func(c *fiber.Ctx) error {
+		// Define the form values
+		type AssignRoleFormValues struct {
+			Role string `json:"role"`
+		}
+
+		// Parse the form values
+		var input AssignRoleFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Parse UUID
+		userID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user ID"})
+		}
+
+		// Check the user exists
+		var user models.User
+		if err := db.First(&user, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve user"})
+		}
+
+		// Grant the role
+		err = services.AssignRole(db, user.ID, input.Role)
+		if errors.Is(err, services.ErrRoleNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not assign role"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully assigned role",
+		})
+	})
+
+	// DELETE /admin/users/:id/roles/:role
+	group.Delete("/users/:id/roles/:role", middlewares.RequirePermission(models.PermissionRolesManage), func(c *fiber.Ctx) error {
+		// Parse UUID
+		userID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user ID"})
+		}
+
+		// Admins cannot lock themselves out
+		current, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		if current.ID == userID && c.Params("role") == models.RoleAdmin {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "cannot remove your own admin role"})
+		}
+
+		// Take the role away
+		err = services.RemoveRole(db, userID, c.Params("role"))
+		if errors.Is(err, services.ErrRoleNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "role not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not remove role"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully removed role",
+		})
+	})
+
+	// GET /admin/audit-events
+	group.Get("/audit-events", middlewares.RequirePermission(models.PermissionAuditRead), func(c *fiber.Ctx) error {
+		// Apply the filters
+		query, errs := auditEventQuery(c, db)
+
+		limit := 100
+		if value := c.Query("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 || parsed > 1000 {
+				errs.Add("limit", "limit must be between 1 and 1000")
+			}
+			limit = parsed
+		}
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Retrieve the newest matching events
+		var events []models.AuditEvent
+		if err := query.Order("created_at DESC").Limit(limit).Find(&events).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve audit events"})
+		}
+
+		// Return the list of events
+		return c.Status(fiber.StatusOK).JSON(events)
+	})
+
+	// GET /admin/audit-events/export
+	group.Get("/audit-events/export", middlewares.RequirePermission(models.PermissionAuditRead), func(c *fiber.Ctx) error {
+		// Apply the filters
+		query, errs := auditEventQuery(c, db)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Stream the matching events as JSON lines, oldest first
+		c.Set(fiber.HeaderContentType, "application/x-ndjson")
+		c.Set(fiber.HeaderContentDisposition, `attachment; filename="audit-events.jsonl"`)
+
+		c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+			encoder := json.NewEncoder(w)
+			query := query.Session(&gorm.Session{})
+
+			// Page by (created_at, id) so events sharing a timestamp are neither skipped nor repeated
+			var last *models.AuditEvent
+			for {
+				page := query.Order("created_at ASC, id ASC").Limit(500)
+				if last != nil {
+					page = page.Where("(created_at, id) > (?, ?)", last.CreatedAt, last.ID)
+				}
+
+				var events []models.AuditEvent
+				if err := page.Find(&events).Error; err != nil {
+					log.Printf("error exporting audit events: %v", err)
+					return
+				}
+				for _, event := range events {
+					if err := encoder.Encode(event); err != nil {
+						return
+					}
+				}
+				if err := w.Flush(); err != nil || len(events) < 500 {
+					return
+				}
+				last = &events[len(events)-1]
+			}
+		})
+
+		return nil
+	})
+
+	// POST /admin/users/:id/impersonate
+	group.Post("/users/:id/impersonate", middlewares.RequirePermission(models.PermissionUsersImpersonate), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ImpersonateFormValues struct {
+			Reason   string `json:"reason"`
+			ReadOnly *bool  `json:"readOnly"`
+			Minutes  int    `json:"minutes"`
+		}
+
+		// Parse the form values
+		var input ImpersonateFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Validate the form values
+		input.Reason = strings.TrimSpace(input.Reason)
+		if input.Minutes == 0 {
+			input.Minutes = int(impersonationDefaultTTL / time.Minute)
+		}
+		readOnly := input.ReadOnly == nil || *input.ReadOnly
+
+		errs := validators.Errors{}
+		validators.Length(errs, "reason", input.Reason, 1, 500)
+		if input.Minutes < 1 || input.Minutes > int(impersonationMaxTTL/time.Minute) {
+			errs.Add("minutes", fmt.Sprintf("minutes must be between 1 and %d", int(impersonationMaxTTL/time.Minute)))
+		}
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Parse UUID
+		userID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user ID"})
+		}
+
+		// Get the authenticated admin and session
+		admin, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		current, ok := c.Locals("session").(models.Session)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		if admin.ID == userID {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "cannot impersonate yourself"})
+		}
+
+		// Find the target user
+		var user models.User
+		if err := db.Preload("Roles").First(&user, "id = ?", userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "user not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve user"})
+		}
+
+		// Impersonation must not become a way to borrow another admin's permissions
+		if len(services.UserPermissions(user)) > 0 {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "cannot impersonate users with administrative roles"})
+		}
+
+		// Create the session
+		expiresAt := time.Now().Add(time.Duration(input.Minutes) * time.Minute)
+
+		token, session, err := services.CreateImpersonationSession(db, admin.ID, user.ID, c.IP(), c.Get("User-Agent"), expiresAt, readOnly)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create session"})
+		}
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionImpersonation,
+			ActorID:    &admin.ID,
+			TargetType: "user",
+			TargetID:   &user.ID,
+			Metadata: map[string]any{
+				"sessionId": session.ID,
+				"readOnly":  readOnly,
+				"expiresAt": expiresAt,
+				"reason":    input.Reason,
+			},
+		})
+
+		// The session replaces the admin's own in this browser, so end the admin's session rather
+		// than leave it behind; signing out of the impersonation leaves the browser signed out
+		if err := services.RevokeSession(db, current); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not end admin session"})
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"sessionId": session.ID,
+			"userId":    user.ID,
+			"readOnly":  readOnly,
+			"expiresAt": expiresAt,
+		})
+	})
+}
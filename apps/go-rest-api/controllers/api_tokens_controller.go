@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func RegisterAPITokenRoutes(group fiber.Router, db *gorm.DB) {
+	// GET /me/tokens
+	group.Get("/", func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Retrieve all active tokens for the user
+		var tokens []models.APIToken
+		if err := db.
+			Where("user_id = ? AND revoked_at IS NULL", user.ID).
+			Order("created_at DESC").
+			Find(&tokens).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve tokens"})
+		}
+
+		result := make([]fiber.Map, 0, len(tokens))
+		for _, token := range tokens {
+			result = append(result, fiber.Map{
+				"id":         token.ID,
+				"name":       token.Name,
+				"prefix":     token.Prefix,
+				"scopes":     token.Scopes,
+				"createdAt":  token.CreatedAt,
+				"expiresAt":  token.ExpiresAt,
+				"lastUsedAt": token.LastUsedAt,
+			})
+		}
+
+		// Return the list of tokens
+		return c.Status(fiber.StatusOK).JSON(result)
+	})
+
+	// POST /me/tokens
+	group.Post("/", func(c *fiber.Ctx) error {
+		// Define the form values
+		type CreateAPITokenFormValues struct {
+			Name      string     `json:"name"`
+			Scopes    []string   `json:"scopes"`
+			ExpiresAt *time.Time `json:"expiresAt"`
+		}
+
+		// Parse the form values
+		var input CreateAPITokenFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Validate the form values
+		input.Name = strings.TrimSpace(input.Name)
+
+		errs := validators.Errors{}
+		validators.Length(errs, "name", input.Name, 1, 255)
+		if len(input.Scopes) == 0 {
+			errs.Add("scopes", "at least one scope is required")
+		}
+		for _, scope := range input.Scopes {
+			if !slices.Contains(models.Scopes, scope) {
+				errs.Add("scopes", "unknown scope: "+scope)
+			}
+		}
+		if input.ExpiresAt != nil && !input.ExpiresAt.After(time.Now()) {
+			errs.Add("expiresAt", "expiresAt must be in the future")
+		}
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Create the token
+		slices.Sort(input.Scopes)
+		token, record, err := services.CreateAPIToken(db, user.ID, input.Name, slices.Compact(input.Scopes), input.ExpiresAt)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create token"})
+		}
+
+		// Return the token, which is only shown once
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"id":        record.ID,
+			"name":      record.Name,
+			"prefix":    record.Prefix,
+			"scopes":    record.Scopes,
+			"createdAt": record.CreatedAt,
+			"expiresAt": record.ExpiresAt,
+			"token":     token,
+		})
+	})
+
+	// DELETE /me/tokens/:id
+	group.Delete("/:id", func(c *fiber.Ctx) error {
+		// Parse UUID
+		tokenID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid token ID"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Revoke the token
+		result := db.Model(&models.APIToken{}).
+			Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, user.ID).
+			Update("revoked_at", time.Now())
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke token"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "token not found"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully revoked token",
+		})
+	})
+}
@@ -0,0 +1,25 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// audit records an event with the client address and user agent of the request. Events
+// from an impersonated session also name the admin behind it.
+func audit(c *fiber.Ctx, db *gorm.DB, event models.AuditEvent) {
+	event.IPAddress = c.IP()
+	event.UserAgent = c.Get(fiber.HeaderUserAgent)
+
+	if session, ok := c.Locals("session").(models.Session); ok && session.ImpersonatorID != nil {
+		if event.Metadata == nil {
+			event.Metadata = map[string]any{}
+		}
+		event.Metadata["impersonatorId"] = *session.ImpersonatorID
+	}
+
+	services.RecordAuditEvent(db, event)
+}
@@ -0,0 +1,212 @@
+package controllers
+
+import (
+	"errors"
+	"log"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	grantTypePassword     = "password"
+	grantTypeRefreshToken = "refresh_token"
+)
+
+// respondTokens issues an access token for the session alongside its refresh token
+func respondTokens(c *fiber.Ctx, session models.Session, refreshToken string) error {
+	accessToken, expiresAt, err := services.IssueAccessToken(session.UserID, session.ID)
+	if err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not issue access token"})
+	}
+
+	c.Set(fiber.HeaderCacheControl, "no-store")
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"accessToken":           accessToken,
+		"tokenType":             "Bearer",
+		"expiresIn":             int(services.AccessTokenTTL.Seconds()),
+		"expiresAt":             expiresAt,
+		"refreshToken":          refreshToken,
+		"refreshTokenExpiresAt": session.ExpiresAt,
+	})
+}
+
+func RegisterAuthRoutes(group fiber.Router, db *gorm.DB) {
+	// GET /auth/jwks.json
+	group.Get("/jwks.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+		return c.Status(fiber.StatusOK).JSON(services.JWKS())
+	})
+
+	// POST /auth/token
+	group.Post("/token", func(c *fiber.Ctx) error {
+		// Define the form values
+		type TokenFormValues struct {
+			GrantType    string `json:"grantType"`
+			Email        string `json:"email"`
+			Password     string `json:"password"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recoveryCode"`
+			RefreshToken string `json:"refreshToken"`
+		}
+
+		// Parse the form values
+		var input TokenFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		switch input.GrantType {
+		case grantTypeRefreshToken:
+			// Rotate the refresh token
+			refreshToken, session, err := services.RotateRefreshToken(db, input.RefreshToken)
+			switch {
+			case errors.Is(err, services.ErrRefreshTokenReused):
+				audit(c, db, models.AuditEvent{
+					Action:     models.AuditActionRefreshTokenReused,
+					ActorID:    &session.UserID,
+					TargetType: "session",
+					TargetID:   &session.ID,
+				})
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid refresh token"})
+			case errors.Is(err, services.ErrInvalidRefreshToken):
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid refresh token"})
+			case err != nil:
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+
+			return respondTokens(c, session, refreshToken)
+
+		case grantTypePassword:
+			// Initialize the login limiter
+			limiter := services.GetLoginLimiter()
+			if limiter == nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+			ipKey := services.LoginIPKey(c.IP())
+			emailKey := services.LoginEmailKey(input.Email)
+
+			// Reject locked out clients and accounts
+			lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+			if lockedFor > 0 {
+				audit(c, db, models.AuditEvent{
+					Action:   models.AuditActionSignInFailed,
+					Metadata: map[string]any{"method": "token", "email": validators.NormalizeEmail(input.Email), "reason": "locked_out"},
+				})
+
+				c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many failed sign-in attempts"})
+			}
+
+			// Find the user
+			var user models.User
+			if err := db.First(&user, "LOWER(email) = ?", validators.NormalizeEmail(input.Email)).Error; err != nil {
+				recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+				audit(c, db, models.AuditEvent{
+					Action:   models.AuditActionSignInFailed,
+					Metadata: map[string]any{"method": "token", "email": validators.NormalizeEmail(input.Email), "reason": "unknown_email"},
+				})
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+			}
+
+			// Check the password
+			if ok, err := services.VerifyPassword(user.Password, input.Password); err != nil || !ok {
+				recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+				audit(c, db, models.AuditEvent{
+					Action:     models.AuditActionSignInFailed,
+					ActorID:    &user.ID,
+					TargetType: "user",
+					TargetID:   &user.ID,
+					Metadata:   map[string]any{"method": "token", "reason": "invalid_password"},
+				})
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+			}
+
+			// Upgrade an outdated password hash now that the plaintext is known
+			services.UpgradePasswordHash(db, user, input.Password)
+
+			// Require the second factor in the same request
+			if user.IsTOTPEnabled {
+				if input.Code == "" && input.RecoveryCode == "" {
+					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+						"error":       "two-factor authentication required",
+						"mfaRequired": true,
+					})
+				}
+
+				valid, err := services.VerifySecondFactor(db, user, input.Code, input.RecoveryCode)
+				if err != nil {
+					return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+				}
+				if !valid {
+					recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+					audit(c, db, models.AuditEvent{
+						Action:     models.AuditActionSignInFailed,
+						ActorID:    &user.ID,
+						TargetType: "user",
+						TargetID:   &user.ID,
+						Metadata:   map[string]any{"method": "token", "reason": "invalid_second_factor"},
+					})
+					return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid code"})
+				}
+			}
+
+			// Clear failures against the account
+			if err := limiter.Reset(c.Context(), emailKey); err != nil {
+				log.Printf("error resetting login failures for user %s: %v", user.ID, err)
+			}
+
+			// Create the session
+			refreshToken, session, err := services.CreateRefreshSession(db, user.ID, c.IP(), c.Get("User-Agent"))
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+
+			audit(c, db, models.AuditEvent{
+				Action:     models.AuditActionSignIn,
+				ActorID:    &user.ID,
+				TargetType: "session",
+				TargetID:   &session.ID,
+				Metadata:   map[string]any{"method": "token"},
+			})
+
+			return respondTokens(c, session, refreshToken)
+
+		default:
+			return respondValidationErrors(c, validators.Errors{"grantType": "grantType must be password or refresh_token"})
+		}
+	})
+
+	// POST /auth/token/revoke
+	group.Post("/token/revoke", func(c *fiber.Ctx) error {
+		// Define the form values
+		type RevokeTokenFormValues struct {
+			RefreshToken string `json:"refreshToken"`
+		}
+
+		// Parse the form values
+		var input RevokeTokenFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Revoke the session; unknown tokens are not an error, so revocation is idempotent
+		if err := services.RevokeRefreshToken(db, input.RefreshToken); err != nil && !errors.Is(err, services.ErrInvalidRefreshToken) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully revoked token",
+		})
+	})
+}
@@ -1,24 +1,40 @@
 package controllers
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
 	"github.com/spanhornet/brambles/packages/database/models"
 )
 
 func RegisterChatRoutes(group fiber.Router, db *gorm.DB) {
 	// GET /chats
-	group.Get("/", func(c *fiber.Ctx) error {
+	group.Get("/", middlewares.RequireScopes(models.ScopeChatsRead), func(c *fiber.Ctx) error {
 		// Get the authenticated user
 		user, ok := c.Locals("user").(models.User)
 		if !ok {
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		// Retrieve all chats for the user with their messages
+		// Retrieve all chats visible to the user with their messages
+		query := db.Preload("Messages").Scopes(services.VisibleTo(user.ID))
+		if organizationID := c.Query("organizationId"); organizationID != "" {
+			id, err := uuid.Parse(organizationID)
+			if err != nil {
+				return c.Status(400).JSON(fiber.Map{"error": "invalid organizationId format"})
+			}
+			query = query.Where("organization_id = ?", id)
+		}
+
 		var chats []models.Chat
-		if err := db.Preload("Messages").Where("user_id = ?", user.ID).Find(&chats).Error; err != nil {
+		if err := query.Find(&chats).Error; err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "could not retrieve chats"})
 		}
 
@@ -27,10 +43,11 @@ func RegisterChatRoutes(group fiber.Router, db *gorm.DB) {
 	})
 
 	// POST /chats
-	group.Post("/", func(c *fiber.Ctx) error {
+	group.Post("/", middlewares.RequireScopes(models.ScopeChatsWrite), func(c *fiber.Ctx) error {
 		// Define the form values
 		type CreateChatFormValues struct {
-			Name string `json:"name"`
+			Name           string     `json:"name"`
+			OrganizationID *uuid.UUID `json:"organizationId"`
 		}
 
 		// Parse the form values
@@ -40,16 +57,37 @@ func RegisterChatRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
 		}
 
+		// Validate the form values
+		input.Name = strings.TrimSpace(input.Name)
+
+		errs := validators.Errors{}
+		validators.Length(errs, "name", input.Name, 0, 255)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
 		// Get the authenticated user
 		user, ok := c.Locals("user").(models.User)
 		if !ok {
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
+		// Chats shared with an organization need a membership
+		if input.OrganizationID != nil {
+			_, err := services.FindMembership(db, *input.OrganizationID, user.ID)
+			if errors.Is(err, services.ErrMembershipNotFound) {
+				return c.Status(404).JSON(fiber.Map{"error": "organization not found"})
+			}
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "could not create chat"})
+			}
+		}
+
 		// Create a chat
 		chat := models.Chat{
-			Name:   input.Name,
-			UserID: user.ID,
+			Name:           input.Name,
+			UserID:         user.ID,
+			OrganizationID: input.OrganizationID,
 		}
 
 		// Save the chat to the database
@@ -57,6 +95,13 @@ func RegisterChatRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(500).JSON(fiber.Map{"error": "could not create chat"})
 		}
 
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionChatCreated,
+			ActorID:    &user.ID,
+			TargetType: "chat",
+			TargetID:   &chat.ID,
+		})
+
 		// Return the chat
 		return c.Status(201).JSON(chat)
 	})
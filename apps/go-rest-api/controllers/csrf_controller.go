@@ -0,0 +1,22 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+)
+
+func RegisterCSRFRoutes(group fiber.Router) {
+	// GET /csrf
+	group.Get("/", func(c *fiber.Ctx) error {
+		// Without a session cookie no token is needed
+		var token *string
+		if t := middlewares.IssueCSRFToken(c); t != "" {
+			token = &t
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"csrfToken": token,
+		})
+	})
+}
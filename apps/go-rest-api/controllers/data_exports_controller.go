@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"errors"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// dataExportResponse describes an export without its storage location
+func dataExportResponse(export models.DataExport) fiber.Map {
+	return fiber.Map{
+		"id":          export.ID,
+		"status":      export.Status,
+		"createdAt":   export.CreatedAt,
+		"completedAt": export.CompletedAt,
+		"expiresAt":   export.ExpiresAt,
+		"size":        export.Size,
+	}
+}
+
+func RegisterDataExportRoutes(group fiber.Router, db *gorm.DB) {
+	// GET /me/exports
+	group.Get("/", func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Retrieve all exports for the user
+		var exports []models.DataExport
+		if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&exports).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve exports"})
+		}
+
+		result := make([]fiber.Map, 0, len(exports))
+		for _, export := range exports {
+			result = append(result, dataExportResponse(export))
+		}
+
+		// Return the list of exports
+		return c.Status(fiber.StatusOK).JSON(result)
+	})
+
+	// POST /me/exports
+	group.Post("/", func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Only one export can be in progress at a time
+		var existing models.DataExport
+		err := db.
+			Where("user_id = ? AND status IN ?", user.ID, []string{models.DataExportStatusPending, models.DataExportStatusRunning}).
+			Where("created_at > ?", time.Now().Add(-time.Hour)).
+			First(&existing).Error
+		if err == nil {
+			return c.Status(fiber.StatusAccepted).JSON(dataExportResponse(existing))
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start export"})
+		}
+
+		// Start the export
+		export, err := services.StartDataExport(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start export"})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(dataExportResponse(export))
+	})
+
+	// GET /me/exports/:id
+	group.Get("/:id", func(c *fiber.Ctx) error {
+		// Parse UUID
+		exportID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid export ID"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Fetch the export
+		var export models.DataExport
+		if err := db.Where("id = ? AND user_id = ?", exportID, user.ID).First(&export).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "export not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve export"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(dataExportResponse(export))
+	})
+
+	// POST /me/exports/:id/download
+	group.Post("/:id/download", func(c *fiber.Ctx) error {
+		// Parse UUID
+		exportID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid export ID"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Fetch the export
+		var export models.DataExport
+		if err := db.Where("id = ? AND user_id = ?", exportID, user.ID).First(&export).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "export not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve export"})
+		}
+		if export.Status != models.DataExportStatusCompleted {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "export is not ready"})
+		}
+		if export.ExpiresAt != nil && time.Now().After(*export.ExpiresAt) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{"error": "export has expired"})
+		}
+
+		// Sign a download link
+		link, expiresAt, err := services.DataExportDownloadURL(c.Context(), export)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create download link"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"url":       link,
+			"expiresAt": expiresAt,
+		})
+	})
+}
@@ -11,6 +11,7 @@ import (
 	"github.com/minio/minio-go/v7"
 	"gorm.io/gorm"
 
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
 	"github.com/spanhornet/brambles/apps/go-rest-api/services"
 	"github.com/spanhornet/brambles/packages/database/models"
 )
@@ -29,16 +30,25 @@ type DocumentJobPayload struct {
 
 func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 	// GET /documents
-	group.Get("/", func(c *fiber.Ctx) error {
+	group.Get("/", middlewares.RequireScopes(models.ScopeDocumentsRead), func(c *fiber.Ctx) error {
 		// Get the authenticated user
 		user, ok := c.Locals("user").(models.User)
 		if !ok {
 			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		// Retrieve all documents for the user
+		// Retrieve all documents visible to the user
+		query := db.Scopes(services.VisibleTo(user.ID))
+		if organizationID := c.Query("organizationId"); organizationID != "" {
+			id, err := uuid.Parse(organizationID)
+			if err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid organizationId format"})
+			}
+			query = query.Where("organization_id = ?", id)
+		}
+
 		var documents []models.Document
-		if err := db.Where("user_id = ?", user.ID).Find(&documents).Error; err != nil {
+		if err := query.Find(&documents).Error; err != nil {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve documents"})
 		}
 
@@ -47,7 +57,7 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 	})
 
 	// POST /documents
-	group.Post("/", func(c *fiber.Ctx) error {
+	group.Post("/", middlewares.RequireScopes(models.ScopeDocumentsWrite), middlewares.RequireVerifiedEmail(), func(c *fiber.Ctx) error {
 		// Get the authenticated user
 		user, ok := c.Locals("user").(models.User)
 		if !ok {
@@ -64,6 +74,15 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid chatId format"})
 		}
 
+		// Check the chat is visible to the user
+		var chat models.Chat
+		if err := db.Scopes(services.VisibleTo(user.ID)).Where("id = ?", chatId).First(&chat).Error; err != nil {
+			if err == gorm.ErrRecordNotFound {
+				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "chat not found"})
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not verify chat access"})
+		}
+
 		// Parse the uploaded file
 		fileHeader, err := c.FormFile("file")
 		if err != nil {
@@ -113,15 +132,16 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 
 		// Create the document
 		doc := models.Document{
-			ID:        documentId,
-			UserID:    user.ID,
-			ChatID:    chatId,
-			FileName:  fileName,
-			FileSize:  fileHeader.Size,
-			MimeType:  mimeType,
-			URL:       url,
-			Bucket:    bucket,
-			ObjectKey: objectKey,
+			ID:             documentId,
+			UserID:         user.ID,
+			ChatID:         chatId,
+			OrganizationID: chat.OrganizationID,
+			FileName:       fileName,
+			FileSize:       fileHeader.Size,
+			MimeType:       mimeType,
+			URL:            url,
+			Bucket:         bucket,
+			ObjectKey:      objectKey,
 		}
 		if err := db.Create(&doc).Error; err != nil {
 			// Handle orphaned file
@@ -129,12 +149,20 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "failed to save document record: " + err.Error()})
 		}
 
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionDocumentUploaded,
+			ActorID:    &user.ID,
+			TargetType: "document",
+			TargetID:   &doc.ID,
+			Metadata:   map[string]any{"chatId": doc.ChatID, "fileName": doc.FileName, "fileSize": doc.FileSize},
+		})
+
 		// Return document
 		return c.Status(fiber.StatusCreated).JSON(doc)
 	})
 
 	// POST /:id/enqueue - Enqueue document for processing
-	group.Post("/:id/enqueue", func(c *fiber.Ctx) error {
+	group.Post("/:id/enqueue", middlewares.RequireScopes(models.ScopeDocumentsWrite), func(c *fiber.Ctx) error {
 		documentID := c.Params("id")
 
 		// Parse UUID
@@ -151,7 +179,7 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 
 		// Fetch the document
 		var document models.Document
-		if err := db.Where("id = ? AND user_id = ?", documentUUID, user.ID).First(&document).Error; err != nil {
+		if err := db.Scopes(services.VisibleTo(user.ID)).Where("id = ?", documentUUID).First(&document).Error; err != nil {
 			if err == gorm.ErrRecordNotFound {
 				return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "document not found"})
 			}
@@ -166,18 +194,19 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 			UserID:    user.ID.String(),
 			ChatID:    document.ChatID.String(),
 			Document: models.Document{
-				ID:        document.ID,
-				UserID:    document.UserID,
-				ChatID:    document.ChatID,
-				CreatedAt: document.CreatedAt,
-				UpdatedAt: document.UpdatedAt,
-				DeletedAt: document.DeletedAt,
-				Bucket:    document.Bucket,
-				ObjectKey: document.ObjectKey,
-				URL:       document.URL,
-				FileName:  document.FileName,
-				FileSize:  document.FileSize,
-				MimeType:  document.MimeType,
+				ID:             document.ID,
+				UserID:         document.UserID,
+				ChatID:         document.ChatID,
+				OrganizationID: document.OrganizationID,
+				CreatedAt:      document.CreatedAt,
+				UpdatedAt:      document.UpdatedAt,
+				DeletedAt:      document.DeletedAt,
+				Bucket:         document.Bucket,
+				ObjectKey:      document.ObjectKey,
+				URL:            document.URL,
+				FileName:       document.FileName,
+				FileSize:       document.FileSize,
+				MimeType:       document.MimeType,
 			},
 		}
 
@@ -199,6 +228,14 @@ func RegisterDocumentRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not enqueue document job"})
 		}
 
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionDocumentEnqueued,
+			ActorID:    &user.ID,
+			TargetType: "document",
+			TargetID:   &document.ID,
+			Metadata:   map[string]any{"jobId": jobPayload.JobID},
+		})
+
 		// Return success response with job details
 		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
 			"job": jobPayload,
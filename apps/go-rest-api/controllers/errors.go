@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+)
+
+// respondValidationErrors rejects a request with per-field validation messages
+func respondValidationErrors(c *fiber.Ctx, errs validators.Errors) error {
+	return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+		"error":  "validation failed",
+		"fields": errs,
+	})
+}
+
+// respondConflict rejects a request whose field value is already used by another record
+func respondConflict(c *fiber.Ctx, field string) error {
+	return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+		"error":  field + " is already in use",
+		"fields": validators.Errors{field: field + " is already in use"},
+	})
+}
+
+// respondUniqueViolation maps a unique constraint violation to a conflict on the
+// offending field, reporting whether err was such a violation
+func respondUniqueViolation(c *fiber.Ctx, err error) (bool, error) {
+	field, ok := validators.UniqueViolation(err)
+	if !ok {
+		return false, nil
+	}
+
+	return true, respondConflict(c, field)
+}
+
+// respondReauthenticationRequired rejects a sensitive change from a passwordless account that
+// has not signed in or re-authenticated with a passkey recently
+func respondReauthenticationRequired(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+		"error": "reauthentication required",
+	})
+}
@@ -0,0 +1,236 @@
+package controllers
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const oidcStateCookie = "oidc_state"
+
+var (
+	errOIDCEmailRequired = errors.New("email_required")
+	errOIDCAccountExists = errors.New("account_exists")
+)
+
+// findOrCreateOIDCUser resolves the user for an external identity, linking it to an existing
+// account with the same verified email or creating a new passkey- and password-less account.
+// Linking to an account whose email was never verified claims it from whoever registered it.
+func findOrCreateOIDCUser(db *gorm.DB, provider string, claims services.OIDCClaims) (models.User, error) {
+	var user models.User
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+
+		// Sign in with a known identity
+		var identity models.Identity
+		err := tx.Preload("User").First(&identity, "provider = ? AND subject = ?", provider, claims.Subject).Error
+		if err == nil {
+			user = identity.User
+			return tx.Model(&identity).Update("last_login_at", now).Error
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		email := validators.NormalizeEmail(claims.Email)
+		if email == "" {
+			return errOIDCEmailRequired
+		}
+
+		// Link to an existing account, but only when the provider vouches for the address
+		err = tx.First(&user, "LOWER(email) = ?", email).Error
+		switch {
+		case err == nil && !claims.EmailVerified:
+			return errOIDCAccountExists
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			// Create a new account
+			firstName, lastName := claims.GivenName, claims.FamilyName
+			if firstName == "" && lastName == "" {
+				firstName, lastName, _ = strings.Cut(claims.Name, " ")
+			}
+
+			user = models.User{
+				FirstName:       firstName,
+				LastName:        lastName,
+				Email:           email,
+				IsEmailVerified: claims.EmailVerified,
+			}
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+		case err != nil:
+			return err
+		}
+
+		// Claim an account registered with an address its creator never proved they control,
+		// since the provider has now confirmed who does
+		if claims.EmailVerified && !user.IsEmailVerified {
+			if err := services.ClaimUnverifiedAccount(tx, user.ID); err != nil {
+				return err
+			}
+			if err := tx.First(&user, "id = ?", user.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&models.Identity{
+			UserID:      user.ID,
+			Provider:    provider,
+			Subject:     claims.Subject,
+			Email:       claims.Email,
+			LastLoginAt: &now,
+		}).Error
+	})
+	if err == nil {
+		services.InvalidateUserSessionCache(context.Background(), user.ID)
+	}
+
+	return user, err
+}
+
+// safeRedirectPath only allows redirects to paths within the web app
+func safeRedirectPath(path string) string {
+	if !strings.HasPrefix(path, "/") || strings.HasPrefix(path, "//") || strings.HasPrefix(path, "/\\") {
+		return "/dashboard"
+	}
+	return path
+}
+
+func RegisterOIDCRoutes(group fiber.Router, db *gorm.DB) {
+	// GET /oidc/:provider/start
+	group.Get("/:provider/start", func(c *fiber.Ctx) error {
+		// Find the provider
+		provider, ok := services.GetOIDCProvider(c.Params("provider"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown provider"})
+		}
+
+		// Store the login state
+		state, err := services.NewOIDCState(provider.Name, c.QueryBool("rememberMe"), safeRedirectPath(c.Query("redirectTo")))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		stateID, err := services.SaveOIDCState(c.Context(), state)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Bind the state to this browser
+		c.Cookie(&fiber.Cookie{
+			Name:     oidcStateCookie,
+			Value:    stateID,
+			Expires:  time.Now().Add(10 * time.Minute),
+			Secure:   true,
+			HTTPOnly: true,
+			SameSite: "Lax",
+			Path:     "/",
+		})
+
+		// Redirect to the provider
+		return c.Redirect(provider.AuthCodeURL(stateID, state), fiber.StatusFound)
+	})
+
+	// GET /oidc/:provider/callback
+	group.Get("/:provider/callback", func(c *fiber.Ctx) error {
+		fail := func(reason string) error {
+			audit(c, db, models.AuditEvent{
+				Action:   models.AuditActionSignInFailed,
+				Metadata: map[string]any{"method": "oidc", "provider": c.Params("provider"), "reason": reason},
+			})
+			return c.Redirect(appURL("/sign-in", url.Values{"error": {reason}}), fiber.StatusFound)
+		}
+
+		// Find the provider
+		provider, ok := services.GetOIDCProvider(c.Params("provider"))
+		if !ok {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "unknown provider"})
+		}
+
+		if c.Query("error") != "" {
+			return fail("access_denied")
+		}
+
+		// Check the state against the one bound to this browser
+		stateID := c.Query("state")
+		cookieState := c.Cookies(oidcStateCookie)
+		c.Cookie(&fiber.Cookie{
+			Name:     oidcStateCookie,
+			Value:    "",
+			Expires:  time.Now().Add(-1 * time.Hour),
+			Secure:   true,
+			HTTPOnly: true,
+			SameSite: "Lax",
+			Path:     "/",
+		})
+		if stateID == "" || subtle.ConstantTimeCompare([]byte(stateID), []byte(cookieState)) != 1 {
+			return fail("invalid_state")
+		}
+
+		state, err := services.TakeOIDCState(c.Context(), stateID)
+		if err != nil || state.Provider != provider.Name {
+			return fail("invalid_state")
+		}
+
+		// Redeem the code and verify the ID token
+		claims, err := provider.Exchange(c.Context(), c.Query("code"), state)
+		if err != nil {
+			log.Printf("error completing %s sign-in: %v", provider.Name, err)
+			return fail("exchange_failed")
+		}
+
+		// Find, link or create the user
+		user, err := findOrCreateOIDCUser(db, provider.Name, claims)
+		switch {
+		case errors.Is(err, errOIDCEmailRequired), errors.Is(err, errOIDCAccountExists):
+			return fail(err.Error())
+		case err != nil:
+			log.Printf("error resolving %s identity: %v", provider.Name, err)
+			return fail("internal_error")
+		}
+
+		// Require the second factor before creating a session
+		if user.IsTOTPEnabled {
+			challenge, err := services.IssueMFAChallenge(db, user.ID, state.RememberMe)
+			if err != nil {
+				return fail("internal_error")
+			}
+			return c.Redirect(appURL("/sign-in/mfa", url.Values{"challenge": {challenge}}), fiber.StatusFound)
+		}
+
+		// Create a session
+		expiresAt := time.Now().Add(24 * time.Hour)
+		if state.RememberMe {
+			expiresAt = time.Now().Add(30 * 24 * time.Hour)
+		}
+
+		token, session, err := services.CreateSession(db, user.ID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return fail("internal_error")
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignIn,
+			ActorID:    &user.ID,
+			TargetType: "session",
+			TargetID:   &session.ID,
+			Metadata:   map[string]any{"method": "oidc", "provider": provider.Name},
+		})
+
+		return c.Redirect(appURL(state.RedirectTo, nil), fiber.StatusFound)
+	})
+}
@@ -0,0 +1,143 @@
+package controllers
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/internal/testdb"
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// registrantCredentials gives an account everything its registrant could have set up
+func registrantCredentials(t *testing.T, db *gorm.DB, userID uuid.UUID) {
+	t.Helper()
+
+	records := []any{
+		&models.Session{UserID: userID, TokenHash: services.HashToken(uuid.NewString()), ExpiresAt: time.Now().Add(time.Hour)},
+		&models.APIToken{UserID: userID, Name: "script", Prefix: "brb_", TokenHash: services.HashToken(uuid.NewString()), Scopes: []string{}},
+		&models.Credential{UserID: userID, CredentialID: []byte(uuid.NewString()), PublicKey: []byte("key")},
+		&models.Identity{UserID: userID, Provider: "github", Subject: uuid.NewString(), Email: "registrant@example.com"},
+		&models.RecoveryCode{UserID: userID, CodeHash: services.HashToken(uuid.NewString())},
+		&models.VerificationToken{UserID: userID, Purpose: models.VerificationTokenPurposeEmailChange, TokenHash: services.HashToken(uuid.NewString()), ExpiresAt: time.Now().Add(time.Hour), Email: "registrant@example.com"},
+	}
+	for _, record := range records {
+		if err := db.Create(record).Error; err != nil {
+			t.Fatalf("error creating %T: %v", record, err)
+		}
+	}
+}
+
+func countRows(t *testing.T, db *gorm.DB, model any, query string, args ...any) int64 {
+	t.Helper()
+
+	var n int64
+	if err := db.Model(model).Where(query, args...).Count(&n).Error; err != nil {
+		t.Fatalf("error counting %T: %v", model, err)
+	}
+	return n
+}
+
+func TestFindOrCreateOIDCUserLinksExistingAccount(t *testing.T) {
+	db := testdb.Open(t)
+
+	hash, err := services.HashPassword("registrant password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name           string
+		emailVerified  bool
+		claimsVerified bool
+		wantErr        error
+		wantClaimed    bool
+	}{
+		{name: "unverified account is claimed from its registrant", emailVerified: false, claimsVerified: true, wantClaimed: true},
+		{name: "verified account keeps its credentials", emailVerified: true, claimsVerified: true},
+		{name: "unverified provider email is refused", emailVerified: false, claimsVerified: false, wantErr: errOIDCAccountExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			existing := testdb.CreateUser(t, db, models.User{
+				Password:        hash,
+				IsEmailVerified: tt.emailVerified,
+				IsTOTPEnabled:   true,
+				TOTPSecret:      "JBSWY3DPEHPK3PXP",
+			})
+			registrantCredentials(t, db, existing.ID)
+
+			user, err := findOrCreateOIDCUser(db, "google", services.OIDCClaims{
+				Subject:       uuid.NewString(),
+				Email:         existing.Email,
+				EmailVerified: tt.claimsVerified,
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var stored models.User
+			if err := db.First(&stored, "id = ?", existing.ID).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.wantErr != nil {
+				if stored.Password != hash || stored.IsEmailVerified {
+					t.Fatalf("refused link changed the account")
+				}
+				return
+			}
+
+			if user.ID != existing.ID {
+				t.Fatalf("linked user %s, want %s", user.ID, existing.ID)
+			}
+			if !stored.IsEmailVerified {
+				t.Errorf("email not marked as verified")
+			}
+			if n := countRows(t, db, &models.Identity{}, "user_id = ? AND provider = ?", existing.ID, "google"); n != 1 {
+				t.Errorf("new identities = %d, want 1", n)
+			}
+
+			remaining := map[string]int64{
+				"sessions":            countRows(t, db, &models.Session{}, "user_id = ?", existing.ID),
+				"api tokens":          countRows(t, db, &models.APIToken{}, "user_id = ?", existing.ID),
+				"passkeys":            countRows(t, db, &models.Credential{}, "user_id = ?", existing.ID),
+				"recovery codes":      countRows(t, db, &models.RecoveryCode{}, "user_id = ?", existing.ID),
+				"verification tokens": countRows(t, db, &models.VerificationToken{}, "user_id = ? AND used_at IS NULL", existing.ID),
+				"identities":          countRows(t, db, &models.Identity{}, "user_id = ? AND provider <> ?", existing.ID, "google"),
+			}
+
+			if !tt.wantClaimed {
+				if stored.Password != hash || !stored.IsTOTPEnabled {
+					t.Errorf("verified account lost its credentials")
+				}
+				for name, n := range remaining {
+					if n == 0 {
+						t.Errorf("verified account lost its %s", name)
+					}
+				}
+				return
+			}
+
+			if stored.Password != "" || user.Password != "" {
+				t.Errorf("registrant's password was kept")
+			}
+			if stored.IsTOTPEnabled || stored.TOTPSecret != "" || user.IsTOTPEnabled {
+				t.Errorf("registrant's TOTP was kept")
+			}
+			if n := countRows(t, db, &models.Identity{}, "user_id = ?", existing.ID); n != 1 {
+				t.Errorf("identities = %d, want only the new one", n)
+			}
+			for name, n := range remaining {
+				if n != 0 {
+					t.Errorf("registrant's %s were kept: %d", name, n)
+				}
+			}
+		})
+	}
+}
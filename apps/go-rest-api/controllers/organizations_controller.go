@@ -0,0 +1,523 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// requireMembership loads the signed-in user's membership in the organization named by the
+// :id parameter and checks it holds at least the given role. On failure it writes the
+// response and returns ok=false.
+func requireMembership(c *fiber.Ctx, db *gorm.DB, minRole string) (models.Membership, bool, error) {
+	user, ok := c.Locals("user").(models.User)
+	if !ok {
+		return models.Membership{}, false, c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+	}
+
+	organizationID, err := uuid.Parse(c.Params("id"))
+	if err != nil {
+		return models.Membership{}, false, c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid organization ID"})
+	}
+
+	membership, err := services.FindMembership(db, organizationID, user.ID)
+	if errors.Is(err, services.ErrMembershipNotFound) {
+		return models.Membership{}, false, c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "organization not found"})
+	}
+	if err != nil {
+		return models.Membership{}, false, c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve organization"})
+	}
+
+	if !services.MembershipRoleAtLeast(membership.Role, minRole) {
+		return models.Membership{}, false, c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+	}
+
+	return membership, true, nil
+}
+
+func RegisterOrganizationRoutes(group fiber.Router, db *gorm.DB) {
+	// GET /organizations
+	group.Get("/", func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Retrieve all memberships for the user
+		var memberships []models.Membership
+		if err := db.
+			Joins("Organization").
+			Where("memberships.user_id = ?", user.ID).
+			Order("\"Organization\".name ASC").
+			Find(&memberships).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve organizations"})
+		}
+
+		result := make([]fiber.Map, 0, len(memberships))
+		for _, membership := range memberships {
+			result = append(result, fiber.Map{
+				"id":        membership.Organization.ID,
+				"name":      membership.Organization.Name,
+				"createdAt": membership.Organization.CreatedAt,
+				"role":      membership.Role,
+			})
+		}
+
+		// Return the list of organizations
+		return c.Status(fiber.StatusOK).JSON(result)
+	})
+
+	// POST /organizations
+	group.Post("/", func(c *fiber.Ctx) error {
+		// Define the form values
+		type CreateOrganizationFormValues struct {
+			Name string `json:"name"`
+		}
+
+		// Parse the form values
+		var input CreateOrganizationFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Validate the form values
+		input.Name = strings.TrimSpace(input.Name)
+
+		errs := validators.Errors{}
+		validators.Length(errs, "name", input.Name, 1, 255)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Create the organization
+		organization, err := services.CreateOrganization(db, user.ID, input.Name)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create organization"})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"id":        organization.ID,
+			"name":      organization.Name,
+			"createdAt": organization.CreatedAt,
+			"role":      models.MembershipRoleOwner,
+		})
+	})
+
+	// POST /organizations/invitations/accept
+	group.Post("/invitations/accept", func(c *fiber.Ctx) error {
+		// Define the form values
+		type AcceptInvitationFormValues struct {
+			Token string `json:"token"`
+		}
+
+		// Parse the form values
+		var input AcceptInvitationFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Join the organization
+		membership, err := services.AcceptInvitation(db, input.Token, user)
+		switch {
+		case errors.Is(err, services.ErrInvalidInvitation):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired invitation"})
+		case errors.Is(err, services.ErrInvitationEmail):
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "invitation was sent to a different email address"})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not accept invitation"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"organizationId": membership.OrganizationID,
+			"role":           membership.Role,
+		})
+	})
+
+	// GET /organizations/:id
+	group.Get("/:id", func(c *fiber.Ctx) error {
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleMember)
+		if !ok {
+			return err
+		}
+
+		// Retrieve the members
+		var members []models.Membership
+		if err := db.
+			Joins("User").
+			Where("memberships.organization_id = ?", membership.OrganizationID).
+			Order("memberships.created_at ASC").
+			Find(&members).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve members"})
+		}
+
+		result := make([]fiber.Map, 0, len(members))
+		for _, member := range members {
+			result = append(result, fiber.Map{
+				"userId":    member.UserID,
+				"firstName": member.User.FirstName,
+				"lastName":  member.User.LastName,
+				"email":     member.User.Email,
+				"role":      member.Role,
+				"joinedAt":  member.CreatedAt,
+			})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"id":        membership.Organization.ID,
+			"name":      membership.Organization.Name,
+			"createdAt": membership.Organization.CreatedAt,
+			"role":      membership.Role,
+			"members":   result,
+		})
+	})
+
+	// PATCH /organizations/:id
+	group.Patch("/:id", func(c *fiber.Ctx) error {
+		// Define the form values
+		type UpdateOrganizationFormValues struct {
+			Name string `json:"name"`
+		}
+
+		// Parse the form values
+		var input UpdateOrganizationFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleAdmin)
+		if !ok {
+			return err
+		}
+
+		// Validate the form values
+		input.Name = strings.TrimSpace(input.Name)
+
+		errs := validators.Errors{}
+		validators.Length(errs, "name", input.Name, 1, 255)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Rename the organization
+		if err := db.Model(&membership.Organization).Update("name", input.Name).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not update organization"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"id":   membership.OrganizationID,
+			"name": input.Name,
+		})
+	})
+
+	// DELETE /organizations/:id
+	group.Delete("/:id", func(c *fiber.Ctx) error {
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleOwner)
+		if !ok {
+			return err
+		}
+
+		// Remove everyone's access, hand shared chats and documents back to their creators as
+		// personal ones, then soft delete the organization
+		err = db.Transaction(func(tx *gorm.DB) error {
+			for _, model := range []any{&models.Chat{}, &models.Document{}} {
+				if err := tx.Unscoped().Model(model).Where("organization_id = ?", membership.OrganizationID).Update("organization_id", nil).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Where("organization_id = ?", membership.OrganizationID).Delete(&models.Invitation{}).Error; err != nil {
+				return err
+			}
+			if err := tx.Where("organization_id = ?", membership.OrganizationID).Delete(&models.Membership{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&models.Organization{}, "id = ?", membership.OrganizationID).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete organization"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully deleted organization",
+		})
+	})
+
+	// PATCH /organizations/:id/members/:userId
+	group.Patch("/:id/members/:userId", func(c *fiber.Ctx) error {
+		// Define the form values
+		type UpdateMemberFormValues struct {
+			Role string `json:"role"`
+		}
+
+		// Parse the form values
+		var input UpdateMemberFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleOwner)
+		if !ok {
+			return err
+		}
+
+		// Validate the form values
+		if !slices.Contains(models.MembershipRoles, input.Role) {
+			return respondValidationErrors(c, validators.Errors{"role": "role must be one of: " + strings.Join(models.MembershipRoles, ", ")})
+		}
+
+		// Parse UUID
+		userID, err := uuid.Parse(c.Params("userId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user ID"})
+		}
+
+		// Organizations always keep an owner
+		if userID == membership.UserID && input.Role != models.MembershipRoleOwner {
+			owners, err := services.CountOwners(db, membership.OrganizationID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not update member"})
+			}
+			if owners <= 1 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "organization must keep an owner"})
+			}
+		}
+
+		// Change the role
+		result := db.Model(&models.Membership{}).
+			Where("organization_id = ? AND user_id = ?", membership.OrganizationID, userID).
+			Update("role", input.Role)
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not update member"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "member not found"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully updated member",
+		})
+	})
+
+	// DELETE /organizations/:id/members/:userId
+	group.Delete("/:id/members/:userId", func(c *fiber.Ctx) error {
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleMember)
+		if !ok {
+			return err
+		}
+
+		// Parse UUID
+		userID, err := uuid.Parse(c.Params("userId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid user ID"})
+		}
+
+		// Members can leave; removing someone else takes an admin
+		if userID != membership.UserID && !services.MembershipRoleAtLeast(membership.Role, models.MembershipRoleAdmin) {
+			return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+		}
+
+		target, err := services.FindMembership(db, membership.OrganizationID, userID)
+		if errors.Is(err, services.ErrMembershipNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "member not found"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not remove member"})
+		}
+
+		// Only owners can remove owners, and the last owner cannot leave
+		if target.Role == models.MembershipRoleOwner {
+			if membership.Role != models.MembershipRoleOwner {
+				return c.Status(fiber.StatusForbidden).JSON(fiber.Map{"error": "forbidden"})
+			}
+			owners, err := services.CountOwners(db, membership.OrganizationID)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not remove member"})
+			}
+			if owners <= 1 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "organization must keep an owner"})
+			}
+		}
+
+		// Remove the member
+		if err := db.Delete(&target).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not remove member"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully removed member",
+		})
+	})
+
+	// GET /organizations/:id/invitations
+	group.Get("/:id/invitations", func(c *fiber.Ctx) error {
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleAdmin)
+		if !ok {
+			return err
+		}
+
+		// Retrieve the pending invitations
+		var invitations []models.Invitation
+		if err := db.
+			Where("organization_id = ? AND accepted_at IS NULL AND expires_at > ?", membership.OrganizationID, time.Now()).
+			Order("created_at DESC").
+			Find(&invitations).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve invitations"})
+		}
+
+		result := make([]fiber.Map, 0, len(invitations))
+		for _, invitation := range invitations {
+			result = append(result, fiber.Map{
+				"id":        invitation.ID,
+				"email":     invitation.Email,
+				"role":      invitation.Role,
+				"createdAt": invitation.CreatedAt,
+				"expiresAt": invitation.ExpiresAt,
+			})
+		}
+
+		// Return the list of invitations
+		return c.Status(fiber.StatusOK).JSON(result)
+	})
+
+	// POST /organizations/:id/invitations
+	group.Post("/:id/invitations", func(c *fiber.Ctx) error {
+		// Define the form values
+		type CreateInvitationFormValues struct {
+			Email string `json:"email"`
+			Role  string `json:"role"`
+		}
+
+		// Parse the form values
+		var input CreateInvitationFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleAdmin)
+		if !ok {
+			return err
+		}
+
+		// Validate the form values
+		input.Email = validators.NormalizeEmail(input.Email)
+		if input.Role == "" {
+			input.Role = models.MembershipRoleMember
+		}
+
+		errs := validators.Errors{}
+		validators.Email(errs, "email", input.Email)
+		if !slices.Contains(models.MembershipRoles, input.Role) {
+			errs.Add("role", "role must be one of: "+strings.Join(models.MembershipRoles, ", "))
+		} else if !services.MembershipRoleAtLeast(membership.Role, input.Role) {
+			errs.Add("role", "cannot invite with a role above your own")
+		}
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Create the invitation
+		token, invitation, err := services.CreateInvitation(db, membership.OrganizationID, user.ID, input.Email, input.Role)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not create invitation"})
+		}
+
+		// Mail the invitation
+		if err := sendInvitationEmail(user, membership.Organization, invitation, token); err != nil {
+			log.Printf("error sending invitation %s: %v", invitation.ID, err)
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"id":        invitation.ID,
+			"email":     invitation.Email,
+			"role":      invitation.Role,
+			"createdAt": invitation.CreatedAt,
+			"expiresAt": invitation.ExpiresAt,
+		})
+	})
+
+	// DELETE /organizations/:id/invitations/:invitationId
+	group.Delete("/:id/invitations/:invitationId", func(c *fiber.Ctx) error {
+		// Check the membership
+		membership, ok, err := requireMembership(c, db, models.MembershipRoleAdmin)
+		if !ok {
+			return err
+		}
+
+		// Parse UUID
+		invitationID, err := uuid.Parse(c.Params("invitationId"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid invitation ID"})
+		}
+
+		// Revoke the invitation
+		result := db.Where("id = ? AND organization_id = ? AND accepted_at IS NULL", invitationID, membership.OrganizationID).Delete(&models.Invitation{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke invitation"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "invitation not found"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully revoked invitation",
+		})
+	})
+}
+
+// sendInvitationEmail mails an organization invitation link to the invitee
+func sendInvitationEmail(inviter models.User, organization models.Organization, invitation models.Invitation, token string) error {
+	mailer := services.GetMailer()
+	if mailer == nil {
+		return errors.New("mailer not initialized")
+	}
+
+	link := appURL("/invitations/accept", url.Values{"token": {token}})
+	return mailer.Send(context.Background(), services.Mail{
+		To:      invitation.Email,
+		Subject: fmt.Sprintf("Join %s on Brambles", organization.Name),
+		Body:    fmt.Sprintf("Hi,\n\n%s %s invited you to join %s. Accept the invitation by opening the link below:\n\n%s\n\nThe link expires in 7 days.\n", inviter.FirstName, inviter.LastName, organization.Name, link),
+	})
+}
@@ -0,0 +1,643 @@
+package controllers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// passkeyRegistrationOptions requires discoverable, user-verified credentials and excludes ones already registered
+func passkeyRegistrationOptions(existing []models.Credential) []webauthn.RegistrationOption {
+	exclusions := make([]protocol.CredentialDescriptor, 0, len(existing))
+	for _, c := range existing {
+		exclusions = append(exclusions, services.ToWebAuthnCredential(c).Descriptor())
+	}
+
+	return []webauthn.RegistrationOption{
+		webauthn.WithExclusions(exclusions),
+		webauthn.WithAuthenticatorSelection(protocol.AuthenticatorSelection{
+			ResidentKey:        protocol.ResidentKeyRequirementRequired,
+			RequireResidentKey: protocol.ResidentKeyRequired(),
+			UserVerification:   protocol.VerificationRequired,
+		}),
+	}
+}
+
+func RegisterPasskeyRoutes(group fiber.Router, db *gorm.DB) {
+	// Define the form values shared by every finish step
+	type FinishCeremonyFormValues struct {
+		CeremonyID string          `json:"ceremonyId"`
+		Credential json.RawMessage `json:"credential"`
+		Name       string          `json:"name"`
+	}
+
+	// GET /passkeys
+	group.Get("/", middlewares.RequireAuth(), func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Retrieve all passkeys for the user
+		var credentials []models.Credential
+		if err := db.Where("user_id = ?", user.ID).Order("created_at").Find(&credentials).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve passkeys"})
+		}
+
+		result := make([]fiber.Map, 0, len(credentials))
+		for _, credential := range credentials {
+			result = append(result, fiber.Map{
+				"id":         credential.ID,
+				"name":       credential.Name,
+				"createdAt":  credential.CreatedAt,
+				"lastUsedAt": credential.LastUsedAt,
+			})
+		}
+
+		// Return the list of passkeys
+		return c.Status(fiber.StatusOK).JSON(result)
+	})
+
+	// DELETE /passkeys/:id
+	group.Delete("/:id", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Parse UUID
+		credentialID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid passkey ID"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err = services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete passkey"})
+		}
+
+		// Passkey-only accounts must keep at least one passkey
+		if user.Password == "" {
+			var count int64
+			if err := db.Model(&models.Credential{}).Where("user_id = ?", user.ID).Count(&count).Error; err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete passkey"})
+			}
+			if count <= 1 {
+				return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "cannot remove the only sign-in method"})
+			}
+		}
+
+		// Delete the passkey
+		result := db.Where("id = ? AND user_id = ?", credentialID, user.ID).Delete(&models.Credential{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not delete passkey"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "passkey not found"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully deleted passkey",
+		})
+	})
+
+	// POST /passkeys/register/begin
+	group.Post("/register/begin", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Load existing passkeys
+		var credentials []models.Credential
+		if err := db.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve passkeys"})
+		}
+
+		// Begin the registration ceremony
+		creation, session, err := webAuthn.BeginRegistration(services.WebAuthnUser{User: user, Credentials: credentials}, passkeyRegistrationOptions(credentials)...)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin registration"})
+		}
+
+		ceremonyID, err := services.SaveWebAuthnCeremony(c.Context(), services.WebAuthnCeremony{
+			Session: *session,
+			UserID:  user.ID,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin registration"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"ceremonyId": ceremonyID,
+			"options":    creation,
+		})
+	})
+
+	// POST /passkeys/register/finish
+	group.Post("/register/finish", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Parse the form values
+		var input FinishCeremonyFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Load the ceremony
+		ceremony, err := services.TakeWebAuthnCeremony(c.Context(), input.CeremonyID)
+		if errors.Is(err, services.ErrWebAuthnCeremonyNotFound) || (err == nil && ceremony.UserID != user.ID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired ceremony"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not finish registration"})
+		}
+
+		// Verify the attestation
+		parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid credential"})
+		}
+
+		var credentials []models.Credential
+		if err := db.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve passkeys"})
+		}
+
+		credential, err := webAuthn.CreateCredential(services.WebAuthnUser{User: user, Credentials: credentials}, ceremony.Session, parsed)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "could not verify credential"})
+		}
+
+		// Save the passkey
+		record := services.FromWebAuthnCredential(user.ID, input.Name, *credential)
+		if err := db.Create(&record).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not save passkey"})
+		}
+
+		return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+			"id":        record.ID,
+			"name":      record.Name,
+			"createdAt": record.CreatedAt,
+		})
+	})
+
+	// POST /passkeys/reauthenticate/begin
+	group.Post("/reauthenticate/begin", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Load the user's passkeys
+		var credentials []models.Credential
+		if err := db.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve passkeys"})
+		}
+		if len(credentials) == 0 {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "no passkeys registered"})
+		}
+
+		// Begin a login ceremony limited to the user's passkeys
+		assertion, session, err := webAuthn.BeginLogin(services.WebAuthnUser{User: user, Credentials: credentials}, webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin reauthentication"})
+		}
+
+		ceremonyID, err := services.SaveWebAuthnCeremony(c.Context(), services.WebAuthnCeremony{
+			Session: *session,
+			UserID:  user.ID,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin reauthentication"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"ceremonyId": ceremonyID,
+			"options":    assertion,
+		})
+	})
+
+	// POST /passkeys/reauthenticate/finish
+	group.Post("/reauthenticate/finish", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Parse the form values
+		var input FinishCeremonyFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user and session
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		current, ok := c.Locals("session").(models.Session)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Load the ceremony
+		ceremony, err := services.TakeWebAuthnCeremony(c.Context(), input.CeremonyID)
+		if errors.Is(err, services.ErrWebAuthnCeremonyNotFound) || (err == nil && ceremony.UserID != user.ID) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired ceremony"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not finish reauthentication"})
+		}
+
+		// Verify the assertion
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid credential"})
+		}
+
+		var credentials []models.Credential
+		if err := db.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve passkeys"})
+		}
+
+		credential, err := webAuthn.ValidateLogin(services.WebAuthnUser{User: user, Credentials: credentials}, ceremony.Session, parsed)
+		if err != nil {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "could not verify passkey"})
+		}
+
+		// Record the new signature counter
+		if err := db.Model(&models.Credential{}).
+			Where("credential_id = ? AND user_id = ?", credential.ID, user.ID).
+			Updates(map[string]any{
+				"sign_count":    int64(credential.Authenticator.SignCount),
+				"clone_warning": credential.Authenticator.CloneWarning,
+				"last_used_at":  time.Now(),
+			}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Let the session make sensitive changes for a while
+		if err := services.MarkSessionAuthenticated(db, current); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":   "successfully reauthenticated",
+			"expiresAt": time.Now().Add(services.ReauthenticationWindow),
+		})
+	})
+
+	// POST /passkeys/sign-up/begin
+	group.Post("/sign-up/begin", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type PasskeySignUpFormValues struct {
+			FirstName string `json:"firstName"`
+			LastName  string `json:"lastName"`
+			Email     string `json:"email"`
+			Phone     string `json:"phone"`
+		}
+
+		// Parse the form values
+		var input PasskeySignUpFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Validate the form values
+		input.FirstName = strings.TrimSpace(input.FirstName)
+		input.LastName = strings.TrimSpace(input.LastName)
+		input.Email = validators.NormalizeEmail(input.Email)
+		input.Phone = validators.NormalizePhone(input.Phone)
+
+		errs := validators.Errors{}
+		validators.Name(errs, "firstName", input.FirstName)
+		validators.Name(errs, "lastName", input.LastName)
+		validators.Email(errs, "email", input.Email)
+		validators.Phone(errs, "phone", input.Phone)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Reject addresses that already have an account
+		if taken, err := emailTaken(db, input.Email); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		} else if taken {
+			return respondConflict(c, "email")
+		}
+
+		var count int64
+		if err := db.Model(&models.User{}).Where("phone = ?", input.Phone).Count(&count).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if count > 0 {
+			return respondConflict(c, "phone")
+		}
+
+		// Begin the registration ceremony for the account to be created
+		user := models.User{
+			ID:        uuid.New(),
+			FirstName: input.FirstName,
+			LastName:  input.LastName,
+			Email:     input.Email,
+			Phone:     &input.Phone,
+		}
+
+		creation, session, err := webAuthn.BeginRegistration(services.WebAuthnUser{User: user}, passkeyRegistrationOptions(nil)...)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin registration"})
+		}
+
+		ceremonyID, err := services.SaveWebAuthnCeremony(c.Context(), services.WebAuthnCeremony{
+			Session:   *session,
+			UserID:    user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Email:     input.Email,
+			Phone:     input.Phone,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin registration"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"ceremonyId": ceremonyID,
+			"options":    creation,
+		})
+	})
+
+	// POST /passkeys/sign-up/finish
+	group.Post("/sign-up/finish", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Parse the form values
+		var input FinishCeremonyFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Load the ceremony
+		ceremony, err := services.TakeWebAuthnCeremony(c.Context(), input.CeremonyID)
+		if errors.Is(err, services.ErrWebAuthnCeremonyNotFound) || (err == nil && ceremony.Email == "") {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid or expired ceremony"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not finish sign-up"})
+		}
+
+		// Verify the attestation
+		parsed, err := protocol.ParseCredentialCreationResponseBytes(input.Credential)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid credential"})
+		}
+
+		user := models.User{
+			ID:        ceremony.UserID,
+			FirstName: ceremony.FirstName,
+			LastName:  ceremony.LastName,
+			Email:     ceremony.Email,
+			Phone:     &ceremony.Phone,
+		}
+
+		credential, err := webAuthn.CreateCredential(services.WebAuthnUser{User: user}, ceremony.Session, parsed)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "could not verify credential"})
+		}
+
+		// Create the passkey-only user and their passkey
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&user).Error; err != nil {
+				return err
+			}
+			record := services.FromWebAuthnCredential(user.ID, input.Name, *credential)
+			return tx.Create(&record).Error
+		})
+		if err != nil {
+			if handled, err := respondUniqueViolation(c, err); handled {
+				return err
+			}
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignUp,
+			ActorID:    &user.ID,
+			TargetType: "user",
+			TargetID:   &user.ID,
+			Metadata:   map[string]any{"method": "passkey"},
+		})
+
+		// Create a session
+		expiresAt := time.Now().Add(24 * time.Hour)
+
+		token, _, err := services.CreateSession(db, user.ID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		// Send the verification email
+		if err := sendVerificationEmail(db, user); err != nil {
+			log.Printf("error sending verification email to user %s: %v", user.ID, err)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully signed up user",
+		})
+	})
+
+	// POST /passkeys/login/begin
+	group.Post("/login/begin", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type PasskeyLoginFormValues struct {
+			RememberMe bool `json:"rememberMe"`
+		}
+
+		// Parse the form values
+		var input PasskeyLoginFormValues
+
+		if len(c.Body()) > 0 {
+			if err := c.BodyParser(&input); err != nil {
+				return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+			}
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Begin a discoverable login ceremony
+		assertion, session, err := webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin login"})
+		}
+
+		ceremonyID, err := services.SaveWebAuthnCeremony(c.Context(), services.WebAuthnCeremony{
+			Session:    *session,
+			RememberMe: input.RememberMe,
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not begin login"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"ceremonyId": ceremonyID,
+			"options":    assertion,
+		})
+	})
+
+	// POST /passkeys/login/finish
+	group.Post("/login/finish", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Parse the form values
+		var input FinishCeremonyFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Initialize the relying party
+		webAuthn := services.GetWebAuthn()
+		if webAuthn == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "WebAuthn not initialized"})
+		}
+
+		// Load the ceremony
+		ceremony, err := services.TakeWebAuthnCeremony(c.Context(), input.CeremonyID)
+		if errors.Is(err, services.ErrWebAuthnCeremonyNotFound) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid or expired ceremony"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not finish login"})
+		}
+
+		// Verify the assertion
+		parsed, err := protocol.ParseCredentialRequestResponseBytes(input.Credential)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid credential"})
+		}
+
+		findUser := func(rawID, userHandle []byte) (webauthn.User, error) {
+			userID, err := uuid.FromBytes(userHandle)
+			if err != nil {
+				return nil, err
+			}
+
+			var user models.User
+			if err := db.First(&user, "id = ?", userID).Error; err != nil {
+				return nil, err
+			}
+
+			var credentials []models.Credential
+			if err := db.Where("user_id = ?", user.ID).Find(&credentials).Error; err != nil {
+				return nil, err
+			}
+
+			return services.WebAuthnUser{User: user, Credentials: credentials}, nil
+		}
+
+		webAuthnUser, credential, err := webAuthn.ValidatePasskeyLogin(findUser, ceremony.Session, parsed)
+		if err != nil {
+			audit(c, db, models.AuditEvent{
+				Action:   models.AuditActionSignInFailed,
+				Metadata: map[string]any{"method": "passkey", "reason": "invalid_passkey"},
+			})
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		user := webAuthnUser.(services.WebAuthnUser).User
+
+		// Record the new signature counter
+		now := time.Now()
+		if err := db.Model(&models.Credential{}).
+			Where("credential_id = ? AND user_id = ?", credential.ID, user.ID).
+			Updates(map[string]any{
+				"sign_count":    int64(credential.Authenticator.SignCount),
+				"clone_warning": credential.Authenticator.CloneWarning,
+				"last_used_at":  now,
+			}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Create a session
+		expiresAt := now.Add(24 * time.Hour)
+		if ceremony.RememberMe {
+			expiresAt = now.Add(30 * 24 * time.Hour)
+		}
+
+		token, session, err := services.CreateSession(db, user.ID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignIn,
+			ActorID:    &user.ID,
+			TargetType: "session",
+			TargetID:   &session.ID,
+			Metadata:   map[string]any{"method": "passkey"},
+		})
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully signed in user",
+		})
+	})
+}
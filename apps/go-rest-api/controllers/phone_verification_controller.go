@@ -0,0 +1,110 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func RegisterPhoneVerificationRoutes(group fiber.Router, db *gorm.DB) {
+	// POST /phone/start
+	group.Post("/start", func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if user.Phone == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no phone number on account"})
+		}
+		if user.IsPhoneVerified {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "phone already verified"})
+		}
+
+		// Initialize the SMS sender
+		smsSender := services.GetSMSSender()
+		if smsSender == nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "SMS sender not initialized"})
+		}
+
+		// Issue a one-time code
+		code, err := services.StartPhoneVerification(c.Context(), user.ID, *user.Phone)
+		var rateLimitErr *services.RateLimitError
+		if errors.As(err, &rateLimitErr) {
+			c.Set(fiber.HeaderRetryAfter, fmt.Sprintf("%d", int(rateLimitErr.RetryAfter.Seconds())))
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many verification codes requested"})
+		}
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start phone verification"})
+		}
+
+		// Send the code
+		if err := smsSender.Send(context.Background(), services.SMS{
+			To:   *user.Phone,
+			Body: fmt.Sprintf("Your Brambles verification code is %s", code),
+		}); err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not send verification code"})
+		}
+
+		return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+			"message": "verification code sent",
+		})
+	})
+
+	// POST /phone/confirm
+	group.Post("/confirm", func(c *fiber.Ctx) error {
+		// Define the form values
+		type ConfirmPhoneFormValues struct {
+			Code string `json:"code"`
+		}
+
+		// Parse the form values
+		var input ConfirmPhoneFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if user.Phone == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no phone number on account"})
+		}
+
+		// Check the code
+		err := services.ConfirmPhoneVerification(c.Context(), user.ID, *user.Phone, input.Code)
+		switch {
+		case errors.Is(err, services.ErrPhoneOTPInvalid):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid code"})
+		case errors.Is(err, services.ErrPhoneOTPNotFound):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "no pending verification, request a new code"})
+		case errors.Is(err, services.ErrPhoneOTPTooManyAttempts):
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many attempts, request a new code"})
+		case err != nil:
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not verify phone"})
+		}
+
+		// Mark the phone as verified, as long as it has not changed in the meantime
+		if err := db.Model(&models.User{}).
+			Where("id = ? AND phone = ?", user.ID, *user.Phone).
+			Update("is_phone_verified", true).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not verify phone"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully verified phone",
+		})
+	})
+}
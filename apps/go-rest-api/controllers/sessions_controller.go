@@ -0,0 +1,132 @@
+package controllers
+
+import (
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func RegisterSessionRoutes(group fiber.Router, db *gorm.DB) {
+	// GET /me/sessions
+	group.Get("/", func(c *fiber.Ctx) error {
+		// Get the authenticated user and session
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		current, _ := c.Locals("session").(models.Session)
+
+		// Retrieve all active sessions for the user
+		var sessions []models.Session
+		if err := db.
+			Where("user_id = ? AND expires_at > ?", user.ID, time.Now()).
+			Order("updated_at DESC").
+			Find(&sessions).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not retrieve sessions"})
+		}
+
+		// Describe each session
+		result := make([]fiber.Map, 0, len(sessions))
+		for _, session := range sessions {
+			var userAgent string
+			if session.UserAgent != nil {
+				userAgent = *session.UserAgent
+			}
+
+			result = append(result, fiber.Map{
+				"id":           session.ID,
+				"createdAt":    session.CreatedAt,
+				"lastActiveAt": session.UpdatedAt,
+				"expiresAt":    session.ExpiresAt,
+				"ipAddress":    session.IPAddress,
+				"userAgent":    session.UserAgent,
+				"device":       services.ParseUserAgent(userAgent),
+				"current":      session.ID == current.ID,
+				"impersonated": session.ImpersonatorID != nil,
+			})
+		}
+
+		// Return the list of sessions
+		return c.Status(fiber.StatusOK).JSON(result)
+	})
+
+	// DELETE /me/sessions/:id
+	group.Delete("/:id", func(c *fiber.Ctx) error {
+		// Parse UUID
+		sessionID, err := uuid.Parse(c.Params("id"))
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid session ID"})
+		}
+
+		// Get the authenticated user and session
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		current, _ := c.Locals("session").(models.Session)
+
+		// Revoke the session
+		result := db.Where("id = ? AND user_id = ?", sessionID, user.ID).Delete(&models.Session{})
+		if result.Error != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke session"})
+		}
+		if result.RowsAffected == 0 {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{"error": "session not found"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSessionRevoked,
+			ActorID:    &user.ID,
+			TargetType: "session",
+			TargetID:   &sessionID,
+		})
+
+		// Clear the cookie when revoking the current session
+		if sessionID == current.ID {
+			clearSessionCookie(c)
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully revoked session",
+		})
+	})
+
+	// POST /me/sessions/revoke-others
+	group.Post("/revoke-others", func(c *fiber.Ctx) error {
+		// Get the authenticated user and session
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		current, ok := c.Locals("session").(models.Session)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Revoke every other session
+		revoked, err := services.RevokeUserSessions(db, user.ID, current.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not revoke sessions"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSessionRevoked,
+			ActorID:    &user.ID,
+			TargetType: "user",
+			TargetID:   &user.ID,
+			Metadata:   map[string]any{"scope": "others", "revoked": revoked},
+		})
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully revoked other sessions",
+			"revoked": revoked,
+		})
+	})
+}
@@ -0,0 +1,253 @@
+package controllers
+
+import (
+	"os"
+	"time"
+
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func RegisterTwoFactorRoutes(group fiber.Router, db *gorm.DB) {
+	// POST /2fa/totp/enroll
+	group.Post("/totp/enroll", func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if user.IsTOTPEnabled {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "two-factor authentication already enabled"})
+		}
+
+		// Generate a secret, pending confirmation
+		secret, err := services.GenerateTOTPSecret()
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate secret"})
+		}
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Update("totp_secret", secret).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not start enrollment"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		// Return the provisioning details
+		issuer := os.Getenv("TOTP_ISSUER")
+		if issuer == "" {
+			issuer = "Brambles"
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"secret":          secret,
+			"provisioningUri": services.TOTPProvisioningURI(issuer, user.Email, secret),
+		})
+	})
+
+	// POST /2fa/totp/confirm
+	group.Post("/totp/confirm", func(c *fiber.Ctx) error {
+		// Define the form values
+		type ConfirmTOTPFormValues struct {
+			Code string `json:"code"`
+		}
+
+		// Parse the form values
+		var input ConfirmTOTPFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err := services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		if user.IsTOTPEnabled {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "two-factor authentication already enabled"})
+		}
+		if user.TOTPSecret == "" {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "enrollment not started"})
+		}
+
+		// Check the code against the pending secret
+		step, valid := services.ValidateTOTP(user.TOTPSecret, input.Code, time.Now(), user.TOTPLastUsedStep)
+		if !valid {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "invalid code"})
+		}
+
+		// Enable two-factor authentication
+		if err := db.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+			"is_totp_enabled":     true,
+			"totp_last_used_step": step,
+		}).Error; err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not enable two-factor authentication"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		// Issue recovery codes
+		codes, err := services.ReplaceRecoveryCodes(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate recovery codes"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message":       "successfully enabled two-factor authentication",
+			"recoveryCodes": codes,
+		})
+	})
+
+	// POST /2fa/totp/disable
+	group.Post("/totp/disable", func(c *fiber.Ctx) error {
+		// Define the form values
+		type DisableTOTPFormValues struct {
+			Password string `json:"password"`
+		}
+
+		// Parse the form values
+		var input DisableTOTPFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err := services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		if !user.IsTOTPEnabled {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "two-factor authentication not enabled"})
+		}
+
+		// Check the password, or a recent sign-in for passwordless accounts
+		if user.Password != "" {
+			// Count wrong passwords against the login limiter, as sign-in does
+			limiter := services.GetLoginLimiter()
+			if limiter == nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+			ipKey := services.LoginIPKey(c.IP())
+			emailKey := services.LoginEmailKey(user.Email)
+
+			lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+			if lockedFor > 0 {
+				c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many failed password attempts"})
+			}
+
+			if ok, err := services.VerifyPassword(user.Password, input.Password); err != nil || !ok {
+				recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password"})
+			}
+		} else if !recentlyAuthenticated(c) {
+			return respondReauthenticationRequired(c)
+		}
+
+		// Disable two-factor authentication and discard recovery codes
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Updates(map[string]any{
+				"is_totp_enabled": false,
+				"totp_secret":     "",
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", user.ID).Delete(&models.RecoveryCode{}).Error
+		})
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not disable two-factor authentication"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"message": "successfully disabled two-factor authentication",
+		})
+	})
+
+	// POST /2fa/recovery-codes
+	group.Post("/recovery-codes", func(c *fiber.Ctx) error {
+		// Define the form values
+		type RegenerateRecoveryCodesFormValues struct {
+			Password string `json:"password"`
+		}
+
+		// Parse the form values
+		var input RegenerateRecoveryCodesFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err := services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		if !user.IsTOTPEnabled {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{"error": "two-factor authentication not enabled"})
+		}
+
+		// Check the password, or a recent sign-in for passwordless accounts
+		if user.Password != "" {
+			// Count wrong passwords against the login limiter, as sign-in does
+			limiter := services.GetLoginLimiter()
+			if limiter == nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+			ipKey := services.LoginIPKey(c.IP())
+			emailKey := services.LoginEmailKey(user.Email)
+
+			lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+			if err != nil {
+				return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "internal server error"})
+			}
+			if lockedFor > 0 {
+				c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+				return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{"error": "too many failed password attempts"})
+			}
+
+			if ok, err := services.VerifyPassword(user.Password, input.Password); err != nil || !ok {
+				recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{"error": "invalid password"})
+			}
+		} else if !recentlyAuthenticated(c) {
+			return respondReauthenticationRequired(c)
+		}
+
+		// Replace the recovery codes
+		codes, err := services.ReplaceRecoveryCodes(db, user.ID)
+		if err != nil {
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{"error": "could not generate recovery codes"})
+		}
+
+		return c.Status(fiber.StatusOK).JSON(fiber.Map{
+			"recoveryCodes": codes,
+		})
+	})
+}
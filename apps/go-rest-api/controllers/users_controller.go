@@ -1,48 +1,358 @@
 package controllers
 
 import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"strings"
 	"time"
 
 	"github.com/gofiber/fiber/v2"
-	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
 	"github.com/spanhornet/brambles/packages/database/models"
 )
 
+const (
+	emailVerificationTTL      = 24 * time.Hour
+	emailVerificationCooldown = time.Minute
+	passwordResetTTL          = time.Hour
+	magicLinkTTL              = 15 * time.Minute
+)
+
 func RegisterUserRoutes(group fiber.Router, db *gorm.DB) {
 	// Get current user (GET /me)
-	group.Get("/me", func(c *fiber.Ctx) error {
-		token := c.Cookies("session")
-		if token == "" {
+	group.Get("/me", middlewares.RequireAuth(), func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		// Find session
-		var session models.Session
-		if err := db.Preload("User").First(&session, "token = ? AND expires_at > ?", token, time.Now()).Error; err != nil {
+		// Flag sessions where an admin is acting as the user
+		profile := userProfile(user)
+		profile["impersonation"] = nil
+		if session, ok := c.Locals("session").(models.Session); ok && session.ImpersonatorID != nil {
+			profile["impersonation"] = fiber.Map{
+				"impersonatorId": session.ImpersonatorID,
+				"readOnly":       session.ReadOnly,
+				"expiresAt":      session.ExpiresAt,
+			}
+		}
+
+		// Return user
+		return c.JSON(profile)
+	})
+
+	// Schedule account deletion (DELETE /me)
+	group.Delete("/me", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type DeleteAccountFormValues struct {
+			Password string `json:"password"`
+		}
+
+		// Parse the form values
+		var input DeleteAccountFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err := services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Check the password, or a recent sign-in for passwordless accounts
+		if user.Password != "" {
+			if ok, err := services.VerifyPassword(user.Password, input.Password); err != nil || !ok {
+				return respondValidationErrors(c, validators.Errors{"password": "password is incorrect"})
+			}
+		} else if !recentlyAuthenticated(c) {
+			return respondReauthenticationRequired(c)
+		}
+
+		// Schedule the deletion and sign out everywhere
+		scheduledAt, err := services.ScheduleAccountDeletion(db, user.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		clearSessionCookie(c)
+
+		return c.Status(202).JSON(fiber.Map{
+			"message":             "account scheduled for deletion; sign in before then to cancel",
+			"deletionScheduledAt": scheduledAt,
+		})
+	})
+
+	// Update current user (PATCH /me)
+	group.Patch("/me", middlewares.RequireAuth(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type UpdateProfileFormValues struct {
+			FirstName *string `json:"firstName"`
+			LastName  *string `json:"lastName"`
+		}
+
+		// Parse the form values
+		var input UpdateProfileFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
+		// Validate the form values
+		errs := validators.Errors{}
+		updates := map[string]any{}
+		if input.FirstName != nil {
+			user.FirstName = strings.TrimSpace(*input.FirstName)
+			validators.Name(errs, "firstName", user.FirstName)
+			updates["first_name"] = user.FirstName
+		}
+		if input.LastName != nil {
+			user.LastName = strings.TrimSpace(*input.LastName)
+			validators.Name(errs, "lastName", user.LastName)
+			updates["last_name"] = user.LastName
+		}
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Update the user
+		if len(updates) > 0 {
+			if err := db.Model(&user).Updates(updates).Error; err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+			services.InvalidateUserSessionCache(c.Context(), user.ID)
+		}
+
 		// Return user
-		user := session.User
+		return c.JSON(userProfile(user))
+	})
+
+	// Change password (POST /me/password)
+	group.Post("/me/password", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ChangePasswordFormValues struct {
+			CurrentPassword string `json:"currentPassword"`
+			NewPassword     string `json:"newPassword"`
+		}
 
-		return c.JSON(fiber.Map{
-			"id":              user.ID,
-			"createdAt":       user.CreatedAt,
-			"updatedAt":       user.UpdatedAt,
-			"firstName":       user.FirstName,
-			"lastName":        user.LastName,
-			"email":           user.Email,
-			"phone":           user.Phone,
-			"isEmailVerified": user.IsEmailVerified,
-			"isPhoneVerified": user.IsPhoneVerified,
+		// Parse the form values
+		var input ChangePasswordFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user and session
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+		current, ok := c.Locals("session").(models.Session)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err := services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Check the current password, or a recent sign-in for passwordless accounts
+		if user.Password != "" {
+			if ok, err := services.VerifyPassword(user.Password, input.CurrentPassword); err != nil || !ok {
+				return respondValidationErrors(c, validators.Errors{"currentPassword": "current password is incorrect"})
+			}
+		} else if !recentlyAuthenticated(c) {
+			return respondReauthenticationRequired(c)
+		}
+
+		// Validate the form values
+		errs := validators.Errors{}
+		validators.Password(errs, "newPassword", input.NewPassword, user.FirstName, user.LastName, user.Email)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Hash the password
+		hashedPassword, err := services.HashPassword(input.NewPassword)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Update the password and revoke every other session
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id = ?", user.ID).Update("password", hashedPassword).Error; err != nil {
+				return err
+			}
+			_, err := services.RevokeUserSessions(tx, user.ID, current.ID)
+			return err
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully changed password",
+		})
+	})
+
+	// Request an email change (POST /me/email)
+	group.Post("/me/email", middlewares.RequireAuth(), middlewares.DenyImpersonation(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ChangeEmailFormValues struct {
+			NewEmail string `json:"newEmail"`
+			Password string `json:"password"`
+		}
+
+		// Parse the form values
+		var input ChangeEmailFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		// Reload the user, since the session carries them without credentials
+		user, err := services.FindUserCredentials(db, user.ID)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Check the password, or a recent sign-in for passwordless accounts
+		if user.Password != "" {
+			if ok, err := services.VerifyPassword(user.Password, input.Password); err != nil || !ok {
+				return respondValidationErrors(c, validators.Errors{"password": "password is incorrect"})
+			}
+		} else if !recentlyAuthenticated(c) {
+			return respondReauthenticationRequired(c)
+		}
+
+		// Validate the form values
+		input.NewEmail = validators.NormalizeEmail(input.NewEmail)
+
+		errs := validators.Errors{}
+		validators.Email(errs, "newEmail", input.NewEmail)
+		if input.NewEmail == validators.NormalizeEmail(user.Email) {
+			errs.Add("newEmail", "new email must be different from the current email")
+		}
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		if taken, err := emailTaken(db, input.NewEmail); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		} else if taken {
+			return respondConflict(c, "newEmail")
+		}
+
+		// Send the confirmation to the new address
+		if err := sendEmailChangeEmail(db, user, input.NewEmail); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "could not send confirmation email"})
+		}
+
+		return c.Status(202).JSON(fiber.Map{
+			"message": "confirmation email sent to the new address",
+		})
+	})
+
+	// Confirm an email change (POST /me/email/confirm)
+	group.Post("/me/email/confirm", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ConfirmEmailChangeFormValues struct {
+			Token string `json:"token"`
+		}
+
+		// Parse the form values
+		var input ConfirmEmailChangeFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Consume the token
+		record, err := services.ConsumeVerificationToken(db, input.Token, models.VerificationTokenPurposeEmailChange)
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		var user models.User
+		if err := db.First(&user, "id = ?", record.UserID).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		oldEmail := user.Email
+
+		// Swap the address. The request asked for IsEmailVerified to be reset on a change, but
+		// the old address's verification never carries over: the address only changes here,
+		// once the confirmation link sent to it has been used, and using that link is the same
+		// proof of control that email verification asks for. Clearing the flag would only make
+		// the user verify the same inbox twice, so it is set for the new address instead.
+		if taken, err := emailTaken(db, record.Email); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		} else if taken {
+			return respondConflict(c, "newEmail")
+		}
+
+		if err := db.Model(&user).Updates(map[string]any{
+			"email":             record.Email,
+			"is_email_verified": true,
+		}).Error; err != nil {
+			if handled, err := respondUniqueViolation(c, err); handled {
+				return err
+			}
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), user.ID)
+
+		// Let the previous address know
+		if mailer := services.GetMailer(); mailer != nil {
+			if err := mailer.Send(context.Background(), services.Mail{
+				To:      oldEmail,
+				Subject: "Your email address was changed",
+				Body:    fmt.Sprintf("Hi %s,\n\nThe email address on your account was changed to %s. If you did not make this change, reset your password and contact support.\n", user.FirstName, record.Email),
+			}); err != nil {
+				log.Printf("error notifying user %s of email change: %v", user.ID, err)
+			}
+		}
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully changed email",
 		})
 	})
 
 	// Sign up a user (POST /sign-up)
-	group.Post("/sign-up", func(c *fiber.Ctx) error {
+	group.Post("/sign-up", middlewares.Public(), func(c *fiber.Ctx) error {
 		// Define the form values
 		type SignUpFormValues struct {
 			FirstName string `json:"firstName"`
@@ -59,8 +369,31 @@ func RegisterUserRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
 		}
 
+		// Validate the form values
+		input.FirstName = strings.TrimSpace(input.FirstName)
+		input.LastName = strings.TrimSpace(input.LastName)
+		input.Email = validators.NormalizeEmail(input.Email)
+		input.Phone = validators.NormalizePhone(input.Phone)
+
+		errs := validators.Errors{}
+		validators.Name(errs, "firstName", input.FirstName)
+		validators.Name(errs, "lastName", input.LastName)
+		validators.Email(errs, "email", input.Email)
+		validators.Phone(errs, "phone", input.Phone)
+		validators.Password(errs, "password", input.Password, input.FirstName, input.LastName, input.Email)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Reject addresses already registered with different casing
+		if taken, err := emailTaken(db, input.Email); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		} else if taken {
+			return respondConflict(c, "email")
+		}
+
 		// Hash the password
-		hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		hashedPassword, err := services.HashPassword(input.Password)
 		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 		}
@@ -70,46 +403,115 @@ func RegisterUserRoutes(group fiber.Router, db *gorm.DB) {
 			FirstName: input.FirstName,
 			LastName:  input.LastName,
 			Email:     input.Email,
-			Phone:     input.Phone,
-			Password:  string(hashedPassword),
+			Phone:     &input.Phone,
+			Password:  hashedPassword,
 		}
 
 		if err := db.Create(&user).Error; err != nil {
+			if handled, err := respondUniqueViolation(c, err); handled {
+				return err
+			}
 			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 		}
 
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignUp,
+			ActorID:    &user.ID,
+			TargetType: "user",
+			TargetID:   &user.ID,
+			Metadata:   map[string]any{"method": "password"},
+		})
+
 		// Create a session
-		token := uuid.New().String()
 		expiresAt := time.Now().Add(24 * time.Hour)
 
-		session := models.Session{
-			UserID:    user.ID,
-			Token:     token,
-			ExpiresAt: expiresAt,
-			IPAddress: ptr(c.IP()),
-			UserAgent: ptr(c.Get("User-Agent")),
+		token, _, err := services.CreateSession(db, user.ID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		// Send the verification email
+		if err := sendVerificationEmail(db, user); err != nil {
+			log.Printf("error sending verification email to user %s: %v", user.ID, err)
+		}
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully signed up user",
+		})
+	})
+
+	// Verify an email address (POST /verify-email)
+	group.Post("/verify-email", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type VerifyEmailFormValues struct {
+			Token string `json:"token"`
+		}
+
+		// Parse the form values
+		var input VerifyEmailFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
 		}
-		if err := db.Create(&session).Error; err != nil {
+
+		// Consume the token
+		record, err := services.ConsumeVerificationToken(db, input.Token, models.VerificationTokenPurposeEmailVerification)
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+		}
+		if err != nil {
 			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 		}
 
-		c.Cookie(&fiber.Cookie{
-			Name:     "session",
-			Value:    token,
-			Expires:  expiresAt,
-			Secure:   true,
-			HTTPOnly: true,
-			SameSite: "Lax",
-			Path:     "/",
+		// Mark the email as verified
+		if err := db.Model(&models.User{}).Where("id = ?", record.UserID).Update("is_email_verified", true).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), record.UserID)
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully verified email",
 		})
+	})
+
+	// Resend the verification email (POST /verify-email/resend)
+	group.Post("/verify-email/resend", middlewares.RequireAuth(), func(c *fiber.Ctx) error {
+		// Get the authenticated user
+		user, ok := c.Locals("user").(models.User)
+		if !ok {
+			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if user.IsEmailVerified {
+			return c.Status(409).JSON(fiber.Map{"error": "email already verified"})
+		}
+
+		// Throttle resends
+		var recent int64
+		if err := db.Model(&models.VerificationToken{}).
+			Where("user_id = ? AND purpose = ? AND created_at > ?", user.ID, models.VerificationTokenPurposeEmailVerification, time.Now().Add(-emailVerificationCooldown)).
+			Count(&recent).Error; err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if recent > 0 {
+			c.Set(fiber.HeaderRetryAfter, fmt.Sprintf("%d", int(emailVerificationCooldown.Seconds())))
+			return c.Status(429).JSON(fiber.Map{"error": "verification email recently sent"})
+		}
+
+		// Send the verification email
+		if err := sendVerificationEmail(db, user); err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "could not send verification email"})
+		}
 
 		return c.Status(200).JSON(fiber.Map{
-			"message": "successfully signed up user",
+			"message": "successfully sent verification email",
 		})
 	})
 
 	// Sign in a user (POST /sign-in)
-	group.Post("/sign-in", func(c *fiber.Ctx) error {
+	group.Post("/sign-in", middlewares.Public(), func(c *fiber.Ctx) error {
 		// Define the form values
 		type SignInFormValues struct {
 			Email      string `json:"email"`
@@ -124,43 +526,345 @@ func RegisterUserRoutes(group fiber.Router, db *gorm.DB) {
 			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
 		}
 
+		// Initialize the login limiter
+		limiter := services.GetLoginLimiter()
+		if limiter == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		ipKey := services.LoginIPKey(c.IP())
+		emailKey := services.LoginEmailKey(input.Email)
+
+		// Reject locked out clients and accounts
+		lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if lockedFor > 0 {
+			audit(c, db, models.AuditEvent{
+				Action:   models.AuditActionSignInFailed,
+				Metadata: map[string]any{"method": "password", "email": validators.NormalizeEmail(input.Email), "reason": "locked_out"},
+			})
+
+			c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+			return c.Status(429).JSON(fiber.Map{"error": "too many failed sign-in attempts"})
+		}
+
 		// Find the user
 		var user models.User
-		if err := db.First(&user, "email = ?", input.Email).Error; err != nil {
+		if err := db.First(&user, "LOWER(email) = ?", validators.NormalizeEmail(input.Email)).Error; err != nil {
+			recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+			audit(c, db, models.AuditEvent{
+				Action:   models.AuditActionSignInFailed,
+				Metadata: map[string]any{"method": "password", "email": validators.NormalizeEmail(input.Email), "reason": "unknown_email"},
+			})
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
 		// Check the password
-		if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(input.Password)); err != nil {
+		if ok, err := services.VerifyPassword(user.Password, input.Password); err != nil || !ok {
+			recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+			audit(c, db, models.AuditEvent{
+				Action:     models.AuditActionSignInFailed,
+				ActorID:    &user.ID,
+				TargetType: "user",
+				TargetID:   &user.ID,
+				Metadata:   map[string]any{"method": "password", "reason": "invalid_password"},
+			})
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
+		// Upgrade an outdated password hash now that the plaintext is known
+		services.UpgradePasswordHash(db, user, input.Password)
+
+		// Require the second factor before creating a session; failures against the account
+		// stay counted until it succeeds, so each new challenge does not buy fresh guesses
+		if user.IsTOTPEnabled {
+			challenge, err := services.IssueMFAChallenge(db, user.ID, input.RememberMe)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+
+			return c.Status(200).JSON(fiber.Map{
+				"message":     "two-factor authentication required",
+				"mfaRequired": true,
+				"challenge":   challenge,
+			})
+		}
+
+		// Clear failures against the account
+		if err := limiter.Reset(c.Context(), emailKey); err != nil {
+			log.Printf("error resetting login failures for user %s: %v", user.ID, err)
+		}
+
 		// Create a session
-		token := uuid.New().String()
 		expiresAt := time.Now().Add(24 * time.Hour)
 		if input.RememberMe {
 			expiresAt = time.Now().Add(30 * 24 * time.Hour)
 		}
 
-		session := models.Session{
-			UserID:    user.ID,
-			Token:     token,
-			ExpiresAt: expiresAt,
-			IPAddress: ptr(c.IP()),
-			UserAgent: ptr(c.Get("User-Agent")),
+		token, session, err := services.CreateSession(db, user.ID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignIn,
+			ActorID:    &user.ID,
+			TargetType: "session",
+			TargetID:   &session.ID,
+			Metadata:   map[string]any{"method": "password"},
+		})
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully signed in user",
+		})
+	})
+
+	// Complete a two-factor sign-in (POST /sign-in/mfa)
+	group.Post("/sign-in/mfa", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type SignInMFAFormValues struct {
+			Challenge    string `json:"challenge"`
+			Code         string `json:"code"`
+			RecoveryCode string `json:"recoveryCode"`
+		}
+
+		// Parse the form values
+		var input SignInMFAFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Find the challenge
+		challenge, err := services.FindVerificationToken(db, input.Challenge, models.VerificationTokenPurposeMFAChallenge)
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or expired challenge"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Initialize the login limiter
+		limiter := services.GetLoginLimiter()
+		if limiter == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		ipKey := services.LoginIPKey(c.IP())
+		emailKey := services.LoginEmailKey(challenge.User.Email)
+
+		// Reject locked out clients and accounts
+		lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if lockedFor > 0 {
+			audit(c, db, models.AuditEvent{
+				Action:     models.AuditActionSignInFailed,
+				ActorID:    &challenge.UserID,
+				TargetType: "user",
+				TargetID:   &challenge.UserID,
+				Metadata:   map[string]any{"method": "mfa", "reason": "locked_out"},
+			})
+
+			c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+			return c.Status(429).JSON(fiber.Map{"error": "too many failed sign-in attempts"})
+		}
+
+		// Check the second factor
+		valid, err := services.VerifySecondFactor(db, challenge.User, input.Code, input.RecoveryCode)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if !valid {
+			if err := services.RecordVerificationTokenFailure(db, challenge, services.MFAChallengeMaxAttempts); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+			recordLoginFailure(c.Context(), limiter, ipKey, emailKey)
+			audit(c, db, models.AuditEvent{
+				Action:     models.AuditActionSignInFailed,
+				ActorID:    &challenge.UserID,
+				TargetType: "user",
+				TargetID:   &challenge.UserID,
+				Metadata:   map[string]any{"method": "mfa", "reason": "invalid_second_factor"},
+			})
+			return c.Status(401).JSON(fiber.Map{"error": "invalid code"})
+		}
+
+		// Redeem the challenge
+		if _, err := services.ConsumeVerificationToken(db, input.Challenge, models.VerificationTokenPurposeMFAChallenge); err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or expired challenge"})
+		}
+
+		// Clear failures against the account
+		if err := limiter.Reset(c.Context(), emailKey); err != nil {
+			log.Printf("error resetting login failures for user %s: %v", challenge.UserID, err)
+		}
+
+		// Create a session
+		expiresAt := time.Now().Add(24 * time.Hour)
+		if challenge.RememberMe {
+			expiresAt = time.Now().Add(30 * 24 * time.Hour)
+		}
+
+		token, session, err := services.CreateSession(db, challenge.UserID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 		}
-		if err := db.Create(&session).Error; err != nil {
+
+		setSessionCookie(c, token, expiresAt)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignIn,
+			ActorID:    &challenge.UserID,
+			TargetType: "session",
+			TargetID:   &session.ID,
+			Metadata:   map[string]any{"method": "mfa"},
+		})
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully signed in user",
+		})
+	})
+
+	// Request a sign-in link (POST /magic-link)
+	group.Post("/magic-link", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type MagicLinkFormValues struct {
+			Email      string `json:"email"`
+			RememberMe bool   `json:"rememberMe"`
+		}
+
+		// Parse the form values
+		var input MagicLinkFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Initialize the login limiter
+		limiter := services.GetLoginLimiter()
+		if limiter == nil {
 			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
 		}
+		ipKey := services.MagicLinkIPKey(c.IP())
+		emailKey := services.MagicLinkEmailKey(input.Email)
 
-		c.Cookie(&fiber.Cookie{
-			Name:     "session",
-			Value:    token,
-			Expires:  expiresAt,
-			Secure:   true,
-			HTTPOnly: true,
-			SameSite: "Lax",
-			Path:     "/",
+		// Throttle requests per client and per address, whether or not the account exists
+		lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if lockedFor > 0 {
+			c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+			return c.Status(429).JSON(fiber.Map{"error": "too many sign-in link requests"})
+		}
+		if _, err := limiter.RecordFailure(c.Context(), ipKey, services.IPMagicLinkPolicy); err != nil {
+			log.Printf("error recording magic link request: %v", err)
+		}
+		if _, err := limiter.RecordFailure(c.Context(), emailKey, services.EmailMagicLinkPolicy); err != nil {
+			log.Printf("error recording magic link request: %v", err)
+		}
+
+		// Send the link in the background so the response does not reveal whether the account exists
+		go func(email string, rememberMe bool) {
+			var user models.User
+			if err := db.First(&user, "LOWER(email) = ?", validators.NormalizeEmail(email)).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					log.Printf("error finding user for magic link: %v", err)
+				}
+				return
+			}
+
+			if err := sendMagicLinkEmail(db, user, rememberMe); err != nil {
+				log.Printf("error sending magic link to user %s: %v", user.ID, err)
+			}
+		}(input.Email, input.RememberMe)
+
+		return c.Status(202).JSON(fiber.Map{
+			"message": "if an account exists for this email, a sign-in link has been sent",
+		})
+	})
+
+	// Sign in with a magic link (POST /magic-link/consume)
+	group.Post("/magic-link/consume", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ConsumeMagicLinkFormValues struct {
+			Token string `json:"token"`
+		}
+
+		// Parse the form values
+		var input ConsumeMagicLinkFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Consume the token
+		record, err := services.ConsumeVerificationToken(db, input.Token, models.VerificationTokenPurposeMagicLink)
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			audit(c, db, models.AuditEvent{
+				Action:   models.AuditActionSignInFailed,
+				Metadata: map[string]any{"method": "magic_link", "reason": "invalid_token"},
+			})
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or expired link"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Find the user
+		var user models.User
+		if err := db.First(&user, "id = ?", record.UserID).Error; err != nil {
+			return c.Status(401).JSON(fiber.Map{"error": "invalid or expired link"})
+		}
+
+		// Claim an account registered with an address its creator never proved they control,
+		// since the link has now shown who does
+		if !user.IsEmailVerified {
+			if err := services.ClaimUnverifiedAccount(db, user.ID); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+			if err := db.First(&user, "id = ?", user.ID).Error; err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+		}
+
+		// Require the second factor before creating a session
+		if user.IsTOTPEnabled {
+			challenge, err := services.IssueMFAChallenge(db, user.ID, record.RememberMe)
+			if err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+
+			return c.Status(200).JSON(fiber.Map{
+				"message":     "two-factor authentication required",
+				"mfaRequired": true,
+				"challenge":   challenge,
+			})
+		}
+
+		// Create a session
+		expiresAt := time.Now().Add(24 * time.Hour)
+		if record.RememberMe {
+			expiresAt = time.Now().Add(30 * 24 * time.Hour)
+		}
+
+		token, session, err := services.CreateSession(db, user.ID, c.IP(), c.Get("User-Agent"), expiresAt)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		setSessionCookie(c, token, expiresAt)
+
+		audit(c, db, models.AuditEvent{
+			Action:     models.AuditActionSignIn,
+			ActorID:    &user.ID,
+			TargetType: "session",
+			TargetID:   &session.ID,
+			Metadata:   map[string]any{"method": "magic_link"},
 		})
 
 		return c.Status(200).JSON(fiber.Map{
@@ -168,26 +872,166 @@ func RegisterUserRoutes(group fiber.Router, db *gorm.DB) {
 		})
 	})
 
+	// Request a password reset (POST /password/forgot)
+	group.Post("/password/forgot", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ForgotPasswordFormValues struct {
+			Email string `json:"email"`
+		}
+
+		// Parse the form values
+		var input ForgotPasswordFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Initialize the login limiter
+		limiter := services.GetLoginLimiter()
+		if limiter == nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		ipKey := services.PasswordResetIPKey(c.IP())
+		emailKey := services.PasswordResetEmailKey(input.Email)
+
+		// Throttle requests per client and per address, whether or not the account exists
+		lockedFor, err := loginLockedFor(c.Context(), limiter, ipKey, emailKey)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		if lockedFor > 0 {
+			c.Set(fiber.HeaderRetryAfter, services.RetryAfterSeconds(lockedFor))
+			return c.Status(429).JSON(fiber.Map{"error": "too many password reset requests"})
+		}
+		if _, err := limiter.RecordFailure(c.Context(), ipKey, services.IPPasswordResetPolicy); err != nil {
+			log.Printf("error recording password reset request: %v", err)
+		}
+		if _, err := limiter.RecordFailure(c.Context(), emailKey, services.EmailPasswordResetPolicy); err != nil {
+			log.Printf("error recording password reset request: %v", err)
+		}
+
+		// Send the reset email in the background so the response does not reveal whether the account exists
+		go func(email string) {
+			var user models.User
+			if err := db.First(&user, "LOWER(email) = ?", validators.NormalizeEmail(email)).Error; err != nil {
+				if !errors.Is(err, gorm.ErrRecordNotFound) {
+					log.Printf("error finding user for password reset: %v", err)
+				}
+				return
+			}
+
+			if err := sendPasswordResetEmail(db, user); err != nil {
+				log.Printf("error sending password reset email to user %s: %v", user.ID, err)
+			}
+		}(input.Email)
+
+		return c.Status(202).JSON(fiber.Map{
+			"message": "if an account exists for this email, a reset link has been sent",
+		})
+	})
+
+	// Reset a password (POST /password/reset)
+	group.Post("/password/reset", middlewares.Public(), func(c *fiber.Ctx) error {
+		// Define the form values
+		type ResetPasswordFormValues struct {
+			Token    string `json:"token"`
+			Password string `json:"password"`
+		}
+
+		// Parse the form values
+		var input ResetPasswordFormValues
+
+		if err := c.BodyParser(&input); err != nil {
+			return c.Status(400).JSON(fiber.Map{"error": "bad request"})
+		}
+
+		// Find the token, to check the password against the user's own details
+		pending, err := services.FindVerificationToken(db, input.Token, models.VerificationTokenPurposePasswordReset)
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Validate the form values
+		errs := validators.Errors{}
+		validators.Password(errs, "password", input.Password, pending.User.FirstName, pending.User.LastName, pending.User.Email)
+		if !errs.Empty() {
+			return respondValidationErrors(c, errs)
+		}
+
+		// Hash the password
+		hashedPassword, err := services.HashPassword(input.Password)
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Consume the token
+		record, err := services.ConsumeVerificationToken(db, input.Token, models.VerificationTokenPurposePasswordReset)
+		if errors.Is(err, services.ErrInvalidVerificationToken) {
+			return c.Status(400).JSON(fiber.Map{"error": "invalid or expired token"})
+		}
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+
+		// Update the password and revoke every existing session
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&models.User{}).Where("id = ?", record.UserID).Update("password", hashedPassword).Error; err != nil {
+				return err
+			}
+			_, err := services.RevokeUserSessions(tx, record.UserID)
+			return err
+		})
+		if err != nil {
+			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		}
+		services.InvalidateUserSessionCache(c.Context(), record.UserID)
+
+		// Lift any sign-in lockout, since the user has proven control of the account
+		var user models.User
+		if limiter := services.GetLoginLimiter(); limiter != nil && db.First(&user, "id = ?", record.UserID).Error == nil {
+			if err := limiter.Reset(c.Context(), services.LoginEmailKey(user.Email)); err != nil {
+				log.Printf("error resetting login failures for user %s: %v", user.ID, err)
+			}
+		}
+
+		return c.Status(200).JSON(fiber.Map{
+			"message": "successfully reset password",
+		})
+	})
+
 	// Sign out a user (POST /sign-out)
-	group.Post("/sign-out", func(c *fiber.Ctx) error {
+	group.Post("/sign-out", middlewares.OptionalAuth(), func(c *fiber.Ctx) error {
+		// Revoke the session the caller authenticated with, whether by cookie or access token,
+		// falling back to the cookie for sessions the middleware could not resolve
+		session, hasSession := c.Locals("session").(models.Session)
 		token := c.Cookies("session")
-		if token == "" {
+		if !hasSession && token == "" {
 			return c.Status(401).JSON(fiber.Map{"error": "unauthorized"})
 		}
 
-		if err := db.Delete(&models.Session{}, "token = ?", token).Error; err != nil {
-			return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+		if hasSession {
+			if err := services.RevokeSession(db, session); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+		}
+		if token != "" {
+			if err := services.RevokeSessionByToken(db, token); err != nil {
+				return c.Status(500).JSON(fiber.Map{"error": "internal server error"})
+			}
+			clearSessionCookie(c)
 		}
 
-		c.Cookie(&fiber.Cookie{
-			Name:     "session",
-			Value:    "",
-			Expires:  time.Now().Add(-1 * time.Hour),
-			Secure:   true,
-			HTTPOnly: true,
-			SameSite: "Lax",
-			Path:     "/",
-		})
+		event := models.AuditEvent{Action: models.AuditActionSignOut, TargetType: "session"}
+		if user, ok := c.Locals("user").(models.User); ok {
+			event.ActorID = &user.ID
+		}
+		if hasSession {
+			event.TargetID = &session.ID
+		}
+		audit(c, db, event)
 
 		return c.Status(200).JSON(fiber.Map{
 			"message": "successfully signed out user",
@@ -195,6 +1039,174 @@ func RegisterUserRoutes(group fiber.Router, db *gorm.DB) {
 	})
 }
 
-func ptr(s string) *string {
-	return &s
+// emailTaken reports whether an account exists for an address, ignoring case
+func emailTaken(db *gorm.DB, email string) (bool, error) {
+	var count int64
+	err := db.Model(&models.User{}).Where("LOWER(email) = ?", validators.NormalizeEmail(email)).Count(&count).Error
+	return count > 0, err
+}
+
+// loginLockedFor returns the longest lockout among the given login limiter keys
+func loginLockedFor(ctx context.Context, limiter services.LoginLimiter, keys ...string) (time.Duration, error) {
+	var longest time.Duration
+	for _, key := range keys {
+		lockedFor, err := limiter.LockedFor(ctx, key)
+		if err != nil {
+			return 0, err
+		}
+		longest = max(longest, lockedFor)
+	}
+	return longest, nil
+}
+
+// recordLoginFailure counts a failed sign-in against the client address and the account
+func recordLoginFailure(ctx context.Context, limiter services.LoginLimiter, ipKey string, emailKey string) {
+	if _, err := limiter.RecordFailure(ctx, ipKey, services.IPLoginPolicy); err != nil {
+		log.Printf("error recording login failure: %v", err)
+	}
+	if _, err := limiter.RecordFailure(ctx, emailKey, services.EmailLoginPolicy); err != nil {
+		log.Printf("error recording login failure: %v", err)
+	}
+}
+
+// setSessionCookie hands the session token to the browser
+func setSessionCookie(c *fiber.Ctx, token string, expiresAt time.Time) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "session",
+		Value:    token,
+		Expires:  expiresAt,
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Path:     "/",
+	})
+}
+
+// clearSessionCookie removes the session cookie from the browser
+func clearSessionCookie(c *fiber.Ctx) {
+	c.Cookie(&fiber.Cookie{
+		Name:     "session",
+		Value:    "",
+		Expires:  time.Now().Add(-1 * time.Hour),
+		Secure:   true,
+		HTTPOnly: true,
+		SameSite: "Lax",
+		Path:     "/",
+	})
+}
+
+// recentlyAuthenticated reports whether the caller's session proved who they are recently, which
+// stands in for the password check on accounts without one. API tokens carry no session and never pass.
+func recentlyAuthenticated(c *fiber.Ctx) bool {
+	session, ok := c.Locals("session").(models.Session)
+	return ok && services.RecentlyAuthenticated(session)
+}
+
+// userProfile describes a user for API responses, leaving out credentials
+func userProfile(user models.User) fiber.Map {
+	return fiber.Map{
+		"id":              user.ID,
+		"createdAt":       user.CreatedAt,
+		"updatedAt":       user.UpdatedAt,
+		"firstName":       user.FirstName,
+		"lastName":        user.LastName,
+		"email":           user.Email,
+		"phone":           user.Phone,
+		"isEmailVerified": user.IsEmailVerified,
+		"isPhoneVerified": user.IsPhoneVerified,
+		"isTotpEnabled":   user.IsTOTPEnabled,
+		"permissions":     services.UserPermissions(user),
+	}
+}
+
+// appURL builds a link into the web app from a path and query parameters
+func appURL(path string, query url.Values) string {
+	base := os.Getenv("APP_URL")
+	if base == "" {
+		base = "http://localhost:3000"
+	}
+	if len(query) == 0 {
+		return base + path
+	}
+	return base + path + "?" + query.Encode()
+}
+
+// sendVerificationEmail issues a new email verification token and mails it to the user
+func sendVerificationEmail(db *gorm.DB, user models.User) error {
+	mailer := services.GetMailer()
+	if mailer == nil {
+		return errors.New("mailer not initialized")
+	}
+
+	token, err := services.IssueVerificationToken(db, user.ID, models.VerificationTokenPurposeEmailVerification, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/verify-email", url.Values{"token": {token}})
+	return mailer.Send(context.Background(), services.Mail{
+		To:      user.Email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nConfirm your email address by opening the link below:\n\n%s\n\nThe link expires in 24 hours.\n", user.FirstName, link),
+	})
+}
+
+// sendPasswordResetEmail issues a new password reset token and mails it to the user
+func sendPasswordResetEmail(db *gorm.DB, user models.User) error {
+	mailer := services.GetMailer()
+	if mailer == nil {
+		return errors.New("mailer not initialized")
+	}
+
+	token, err := services.IssueVerificationToken(db, user.ID, models.VerificationTokenPurposePasswordReset, passwordResetTTL)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/reset-password", url.Values{"token": {token}})
+	return mailer.Send(context.Background(), services.Mail{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    fmt.Sprintf("Hi %s,\n\nReset your password by opening the link below:\n\n%s\n\nThe link expires in 1 hour. If you did not request a reset, you can ignore this email.\n", user.FirstName, link),
+	})
+}
+
+// sendMagicLinkEmail issues a new sign-in link and mails it to the user
+func sendMagicLinkEmail(db *gorm.DB, user models.User, rememberMe bool) error {
+	mailer := services.GetMailer()
+	if mailer == nil {
+		return errors.New("mailer not initialized")
+	}
+
+	token, err := services.IssueMagicLinkToken(db, user.ID, rememberMe, magicLinkTTL)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/sign-in/magic-link", url.Values{"token": {token}})
+	return mailer.Send(context.Background(), services.Mail{
+		To:      user.Email,
+		Subject: "Your sign-in link",
+		Body:    fmt.Sprintf("Hi %s,\n\nSign in by opening the link below:\n\n%s\n\nThe link expires in 15 minutes and can be used once. If you did not request it, you can ignore this email.\n", user.FirstName, link),
+	})
+}
+
+// sendEmailChangeEmail issues an email change token and mails it to the new address
+func sendEmailChangeEmail(db *gorm.DB, user models.User, newEmail string) error {
+	mailer := services.GetMailer()
+	if mailer == nil {
+		return errors.New("mailer not initialized")
+	}
+
+	token, err := services.IssueEmailChangeToken(db, user.ID, newEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+
+	link := appURL("/confirm-email-change", url.Values{"token": {token}})
+	return mailer.Send(context.Background(), services.Mail{
+		To:      newEmail,
+		Subject: "Confirm your new email address",
+		Body:    fmt.Sprintf("Hi %s,\n\nConfirm this address for your account by opening the link below:\n\n%s\n\nThe link expires in 24 hours.\n", user.FirstName, link),
+	})
 }
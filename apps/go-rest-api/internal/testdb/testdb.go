@@ -0,0 +1,68 @@
+// Package testdb connects tests to a disposable Postgres database.
+package testdb
+
+import (
+	"os"
+	"testing"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// Open connects to TEST_DATABASE_URL and migrates it, skipping the test when it is unset.
+// Tests share the database, so each should create its own rows rather than assume it is empty.
+func Open(t testing.TB) *gorm.DB {
+	t.Helper()
+
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+
+	db, err := database.ConnectToDatabase(dsn)
+	if err != nil {
+		t.Fatalf("error connecting to test database: %v", err)
+	}
+	if err := db.Exec(`CREATE EXTENSION IF NOT EXISTS "uuid-ossp"`).Error; err != nil {
+		t.Fatalf("error enabling uuid-ossp: %v", err)
+	}
+	if err := database.Migrate(db); err != nil {
+		t.Fatalf("error migrating test database: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	return db
+}
+
+// CreateUser inserts a user with a unique email unless one is given, and removes it and
+// everything that cascades from it when the test ends
+func CreateUser(t testing.TB, db *gorm.DB, user models.User) models.User {
+	t.Helper()
+
+	if user.Email == "" {
+		user.Email = uuid.NewString() + "@example.com"
+	}
+	if user.FirstName == "" {
+		user.FirstName = "Test"
+	}
+	if user.LastName == "" {
+		user.LastName = "User"
+	}
+
+	if err := db.Create(&user).Error; err != nil {
+		t.Fatalf("error creating user: %v", err)
+	}
+	t.Cleanup(func() {
+		db.Unscoped().Delete(&models.User{}, "id = ?", user.ID)
+	})
+
+	return user
+}
@@ -17,6 +17,7 @@ import (
 	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
 	"github.com/spanhornet/brambles/apps/go-rest-api/routes"
 	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/apps/go-rest-api/validators"
 	"github.com/spanhornet/brambles/packages/database"
 )
 
@@ -51,6 +52,14 @@ func main() {
 	}
 	slidingTTL := time.Duration(slidingMinutes) * time.Minute
 
+	touchMinutes := 5
+	if v := os.Getenv("SESSION_TOUCH_INTERVAL_MINUTES"); v != "" {
+		if parsed, err := time.ParseDuration(v + "m"); err == nil {
+			touchMinutes = int(parsed.Minutes())
+		}
+	}
+	touchInterval := time.Duration(touchMinutes) * time.Minute
+
 	// Connect to database
 	db, err := database.ConnectToDatabase(dsn)
 	if err != nil {
@@ -58,6 +67,18 @@ func main() {
 	}
 	migrate(db)
 
+	// Seed roles
+	if err := services.SeedRoles(db); err != nil {
+		log.Fatalf("error seeding roles: %v", err)
+	}
+
+	// Hash any session tokens still stored in plaintext
+	if converted, err := services.MigrateLegacySessionTokens(db); err != nil {
+		log.Printf("error migrating legacy session tokens: %v", err)
+	} else if converted > 0 {
+		log.Printf("migrated %d legacy session tokens", converted)
+	}
+
 	// Initialize Cloudflare R2 client
 	if err := services.InitCloudflareR2Client(); err != nil {
 		log.Fatalf("error initializing Cloudflare R2 client: %v", err)
@@ -70,6 +91,63 @@ func main() {
 	}
 	log.Println("Redis Cloud client initialized successfully")
 
+	// Initialize mailer
+	if err := services.InitMailer(); err != nil {
+		log.Fatalf("error initializing mailer: %v", err)
+	}
+	log.Println("Mailer initialized successfully")
+
+	// Initialize SMS sender
+	if err := services.InitSMSSender(); err != nil {
+		log.Fatalf("error initializing SMS sender: %v", err)
+	}
+	log.Println("SMS sender initialized successfully")
+
+	// Initialize WebAuthn relying party
+	if err := services.InitWebAuthn(); err != nil {
+		log.Fatalf("error initializing WebAuthn: %v", err)
+	}
+	log.Println("WebAuthn initialized successfully")
+
+	// Discover OpenID Connect providers
+	if err := services.InitOIDCProviders(context.Background()); err != nil {
+		log.Fatalf("error initializing OIDC providers: %v", err)
+	}
+	log.Println("OIDC providers initialized successfully")
+
+	// Load access token signing keys
+	if err := services.InitJWTKeys(); err != nil {
+		log.Fatalf("error initializing JWT keys: %v", err)
+	}
+	log.Println("JWT keys initialized successfully")
+
+	// Configure password hashing
+	if err := services.InitPasswordHasher(); err != nil {
+		log.Fatalf("error initializing password hasher: %v", err)
+	}
+	log.Println("Password hasher initialized successfully")
+
+	// Locate the breached-password corpus
+	if err := services.InitBreachedPasswords(); err != nil {
+		log.Fatalf("error initializing breached passwords: %v", err)
+	}
+	if services.BreachedPasswordsEnabled() {
+		validators.DefaultPasswordPolicy.Breached = services.IsBreachedPassword
+		log.Println("Breached passwords initialized successfully")
+	}
+
+	// Initialize login limiter
+	if err := services.InitLoginLimiter(); err != nil {
+		log.Fatalf("error initializing login limiter: %v", err)
+	}
+	log.Println("Login limiter initialized successfully")
+
+	// Purge accounts whose deletion grace period has ended
+	services.StartAccountPurger(context.Background(), db, time.Hour)
+
+	// Remove export archives that can no longer be downloaded
+	services.StartDataExportSweeper(context.Background(), db, time.Hour)
+
 	// Create app
 	app := fiber.New(fiber.Config{
 		Prefork:      false,
@@ -80,19 +158,28 @@ func main() {
 	app.Use(cors.New(cors.Config{
 		AllowOrigins:     corsOrigin,
 		AllowCredentials: true,
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, X-CSRF-Token",
 	}))
 
 	app.Use(logger.New())
 
-	app.Use(middlewares.SessionsMiddleware(db, slidingTTL))
+	app.Use(middlewares.CSRFMiddleware())
+
+	app.Use(middlewares.SessionsMiddleware(db, slidingTTL, touchInterval))
+
+	app.Use(middlewares.ReadOnlySessionsMiddleware(version + "/users/sign-out"))
 
 	// Routes
-	app.Get("/health", func(c *fiber.Ctx) error { return c.SendString("OK") })
+	app.Get("/health", middlewares.Public(), func(c *fiber.Ctx) error { return c.SendString("OK") })
 
 	v1 := app.Group(version)
+	routes.RegisterCSRFRoutes(v1)
+	routes.RegisterAuthRoutes(v1, db)
 	routes.RegisterUserRoutes(v1, db)
 	routes.RegisterChatRoutes(v1, db)
 	routes.RegisterDocumentRoutes(v1, db)
+	routes.RegisterOrganizationRoutes(v1, db)
+	routes.RegisterAdminRoutes(v1, db)
 
 	// Launch server
 	go func() {
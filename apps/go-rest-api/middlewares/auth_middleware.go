@@ -0,0 +1,77 @@
+package middlewares
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// ReadOnlySessionsMiddleware limits read-only sessions, such as default impersonation sessions,
+// to safe methods on every route, however the route declares its auth. The paths listed, like
+// sign-out, stay open so such a session can still end itself. It runs after SessionsMiddleware.
+func ReadOnlySessionsMiddleware(allowed ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		session, ok := c.Locals(ctxSessionKey).(models.Session)
+		if !ok || !session.ReadOnly {
+			return c.Next()
+		}
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions:
+			return c.Next()
+		}
+		if slices.Contains(allowed, strings.TrimSuffix(c.Path(), "/")) {
+			return c.Next()
+		}
+
+		return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "session is read-only"})
+	}
+}
+
+// RequireAuth rejects requests that SessionsMiddleware could not resolve to a user
+func RequireAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals(ctxUserKey).(models.User); !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		return c.Next()
+	}
+}
+
+// DenyImpersonation rejects impersonated sessions, read-only or not, on routes that manage
+// credentials or the account itself, so an admin acting as a user cannot leave behind a way
+// back in or take the account over
+func DenyImpersonation() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if session, ok := c.Locals(ctxSessionKey).(models.Session); ok && session.ImpersonatorID != nil {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "not available while impersonating"})
+		}
+
+		return c.Next()
+	}
+}
+
+// OptionalAuth declares a route that serves anonymous and signed-in callers alike; the
+// handler checks c.Locals("user") itself
+func OptionalAuth() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		return c.Next()
+	}
+}
+
+// Public declares a route that never acts on behalf of a signed-in user, such as sign-in or
+// password reset. Any resolved identity is dropped so the handler cannot depend on it.
+func Public() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(ctxUserKey, nil)
+		c.Locals(ctxSessionKey, nil)
+		c.Locals(ctxAPITokenKey, nil)
+
+		return c.Next()
+	}
+}
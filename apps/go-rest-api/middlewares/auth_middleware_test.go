@@ -0,0 +1,53 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func TestReadOnlySessionsMiddleware(t *testing.T) {
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		session *models.Session
+		want    int
+	}{
+		{name: "read-only get", method: http.MethodGet, path: "/chats", session: &models.Session{ReadOnly: true}, want: fiber.StatusNoContent},
+		{name: "read-only post", method: http.MethodPost, path: "/chats", session: &models.Session{ReadOnly: true}, want: fiber.StatusForbidden},
+		{name: "read-only delete", method: http.MethodDelete, path: "/chats/1", session: &models.Session{ReadOnly: true}, want: fiber.StatusForbidden},
+		{name: "read-only sign-out", method: http.MethodPost, path: "/sign-out", session: &models.Session{ReadOnly: true}, want: fiber.StatusNoContent},
+		{name: "read-only sign-out with trailing slash", method: http.MethodPost, path: "/sign-out/", session: &models.Session{ReadOnly: true}, want: fiber.StatusNoContent},
+		{name: "writable post", method: http.MethodPost, path: "/chats", session: &models.Session{}, want: fiber.StatusNoContent},
+		{name: "anonymous post", method: http.MethodPost, path: "/chats", want: fiber.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			app := fiber.New()
+			app.Use(func(c *fiber.Ctx) error {
+				if tt.session != nil {
+					c.Locals(ctxSessionKey, *tt.session)
+				}
+				return c.Next()
+			})
+			app.Use(ReadOnlySessionsMiddleware("/sign-out"))
+			app.All("/*", func(c *fiber.Ctx) error {
+				return c.SendStatus(fiber.StatusNoContent)
+			})
+
+			resp, err := app.Test(httptest.NewRequest(tt.method, tt.path, nil))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
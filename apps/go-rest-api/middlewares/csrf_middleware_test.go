@@ -0,0 +1,72 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	app := fiber.New()
+	app.Use(CSRFMiddleware())
+	app.All("/", func(c *fiber.Ctx) error {
+		return c.SendStatus(fiber.StatusNoContent)
+	})
+
+	const session = "session-token"
+	valid := services.CSRFToken(services.HashSessionToken(session))
+	other := services.CSRFToken(services.HashSessionToken("another-session-token"))
+
+	tests := []struct {
+		name   string
+		method string
+		cookie string
+		header string
+		// csrfCookie is a csrf_token cookie planted by a sibling subdomain
+		csrfCookie string
+		bearer     bool
+		want       int
+	}{
+		{name: "safe method without token", method: http.MethodGet, cookie: session, want: fiber.StatusNoContent},
+		{name: "head without token", method: http.MethodHead, cookie: session, want: fiber.StatusNoContent},
+		{name: "no session cookie", method: http.MethodPost, want: fiber.StatusNoContent},
+		{name: "bearer request", method: http.MethodPost, cookie: session, bearer: true, want: fiber.StatusNoContent},
+		{name: "valid token", method: http.MethodPost, cookie: session, header: valid, want: fiber.StatusNoContent},
+		{name: "valid token on delete", method: http.MethodDelete, cookie: session, header: valid, want: fiber.StatusNoContent},
+		{name: "missing token", method: http.MethodPost, cookie: session, want: fiber.StatusForbidden},
+		{name: "missing token on patch", method: http.MethodPatch, cookie: session, want: fiber.StatusForbidden},
+		{name: "wrong token", method: http.MethodPut, cookie: session, header: "not-a-token", want: fiber.StatusForbidden},
+		{name: "another session's token", method: http.MethodPost, cookie: session, header: other, want: fiber.StatusForbidden},
+		{name: "tossed cookie echoed in header", method: http.MethodPost, cookie: session, header: "attacker", csrfCookie: "attacker", want: fiber.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/", nil)
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: cookieName, Value: tt.cookie})
+			}
+			if tt.csrfCookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.csrfCookie})
+			}
+			if tt.header != "" {
+				req.Header.Set(csrfHeaderName, tt.header)
+			}
+			if tt.bearer {
+				req.Header.Set(fiber.HeaderAuthorization, bearerPrefix+"access-token")
+			}
+
+			resp, err := app.Test(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
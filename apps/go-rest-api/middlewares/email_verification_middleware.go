@@ -0,0 +1,25 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// RequireVerifiedEmail rejects authenticated users who have not confirmed their email address
+func RequireVerifiedEmail() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals(ctxUserKey).(models.User)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		if !user.IsEmailVerified {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "email address is not verified"})
+		}
+
+		return c.Next()
+	}
+}
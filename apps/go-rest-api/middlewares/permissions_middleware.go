@@ -0,0 +1,32 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// RequirePermission restricts routes to users whose roles grant every listed permission.
+// It runs after SessionsMiddleware, which loads the user's roles.
+func RequirePermission(permissions ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		user, ok := c.Locals(ctxUserKey).(models.User)
+		if !ok {
+			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		}
+
+		for _, permission := range permissions {
+			if !services.HasPermission(user, permission) {
+				return c.Status(http.StatusForbidden).JSON(fiber.Map{
+					"error":               "forbidden",
+					"requiredPermissions": permissions,
+				})
+			}
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// RequireScopes declares the scopes a route needs when called with an API token.
+// Session-authenticated requests act with the full authority of the user and pass through.
+func RequireScopes(scopes ...string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		token, ok := c.Locals(ctxAPITokenKey).(models.APIToken)
+		if !ok {
+			return c.Next()
+		}
+
+		if !services.HasScopes(token, scopes...) {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{
+				"error":          "insufficient scope",
+				"requiredScopes": scopes,
+			})
+		}
+
+		return c.Next()
+	}
+}
+
+// DenyAPITokens restricts routes to signed-in sessions, for account management that API tokens must not reach
+func DenyAPITokens() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if _, ok := c.Locals(ctxAPITokenKey).(models.APIToken); ok {
+			return c.Status(http.StatusForbidden).JSON(fiber.Map{"error": "API tokens cannot access this endpoint"})
+		}
+
+		return c.Next()
+	}
+}
@@ -8,65 +8,108 @@ import (
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
 
-	"github.com/spanhornet/brambles/packages/database/models"
+	"github.com/spanhornet/brambles/apps/go-rest-api/services"
 )
 
 const (
-	cookieName   = "session"
-	ctxUserKey   = "user"
-	bearerPrefix = "Bearer "
+	cookieName     = "session"
+	ctxUserKey     = "user"
+	ctxSessionKey  = "session"
+	ctxAPITokenKey = "apiToken"
+	bearerPrefix   = "Bearer "
 )
 
-func SessionsMiddleware(db *gorm.DB, slidingTTL time.Duration) fiber.Handler {
+// SessionsMiddleware resolves the caller from a session token, JWT access token or API token
+// and attaches them to the context. It never rejects a request for lacking credentials;
+// routes declare their needs with RequireAuth, OptionalAuth or Public.
+func SessionsMiddleware(db *gorm.DB, slidingTTL time.Duration, touchInterval time.Duration) fiber.Handler {
 	return func(c *fiber.Ctx) error {
-		if c.Path() == "/api/v1/users/sign-in" || c.Path() == "/api/v1/users/sign-up" {
-			return c.Next()
+		// Extract token, preferring the Authorization header so that requests exempt from
+		// the CSRF check never act with the cookie's credentials
+		var token string
+		auth := c.Get("Authorization")
+		if len(auth) > len(bearerPrefix) && auth[:len(bearerPrefix)] == bearerPrefix {
+			token = auth[len(bearerPrefix):]
+		} else {
+			token = c.Cookies(cookieName)
 		}
 
-		// Extract token
-		token := c.Cookies(cookieName)
 		if token == "" {
-			auth := c.Get("Authorization")
-			if len(auth) > len(bearerPrefix) && auth[:len(bearerPrefix)] == bearerPrefix {
-				token = auth[len(bearerPrefix):]
+			return c.Next()
+		}
+
+		// Validate API token
+		if services.IsAPIToken(token) {
+			apiToken, err := services.FindAPIToken(db, token)
+
+			switch {
+			case errors.Is(err, services.ErrAPITokenNotFound):
+				return c.Next()
+			case err != nil:
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal error"})
 			}
+
+			// Attach user and token to context
+			apiToken.User = services.WithoutCredentials(apiToken.User)
+			c.Locals(ctxUserKey, apiToken.User)
+			c.Locals(ctxAPITokenKey, apiToken)
+
+			return c.Next()
 		}
 
-		if token == "" {
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		// Validate access token and the session it was issued for
+		if services.IsAccessToken(token) {
+			claims, err := services.ParseAccessToken(token)
+			if err != nil {
+				return c.Next()
+			}
+
+			session, err := services.LookupAccessTokenSession(c.Context(), db, claims)
+
+			switch {
+			case errors.Is(err, services.ErrInvalidAccessToken):
+				return c.Next()
+			case err != nil:
+				return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal error"})
+			}
+
+			// Attach user and session to context
+			c.Locals(ctxUserKey, session.User)
+			c.Locals(ctxSessionKey, session)
+
+			return c.Next()
 		}
 
 		// Validate token
-		var session models.Session
-		err := db.
-			Preload("User").
-			Where("token = ? AND expires_at > ?", token, time.Now()).
-			First(&session).Error
+		session, err := services.LookupSession(c.Context(), db, token)
 
 		switch {
-		case errors.Is(err, gorm.ErrRecordNotFound):
-			return c.Status(http.StatusUnauthorized).JSON(fiber.Map{"error": "unauthorized"})
+		case errors.Is(err, services.ErrSessionNotFound):
+			return c.Next()
 		case err != nil:
 			return c.Status(http.StatusInternalServerError).JSON(fiber.Map{"error": "internal error"})
 		}
 
 		// Extend session
 		if slidingTTL > 0 {
-			newExp := time.Now().Add(slidingTTL)
-			_ = db.Model(&session).Update("expires_at", newExp).Error
-
-			c.Cookie(&fiber.Cookie{
-				Name:     cookieName,
-				Value:    token,
-				Expires:  newExp,
-				HTTPOnly: true,
-				Secure:   c.Protocol() == "https",
-				SameSite: "Lax",
-			})
+			newExp, extended, err := services.TouchSession(c.Context(), db, session, slidingTTL, touchInterval)
+			if err == nil && extended {
+				session.ExpiresAt = newExp
+
+				c.Cookie(&fiber.Cookie{
+					Name:     cookieName,
+					Value:    token,
+					Expires:  newExp,
+					HTTPOnly: true,
+					Secure:   c.Protocol() == "https",
+					SameSite: "Lax",
+				})
+			}
 		}
 
-		// Attach user to context
+		// Attach user and session to context
 		c.Locals(ctxUserKey, session.User)
+		c.Locals(ctxSessionKey, session)
 
 		return c.Next()
 	}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/controllers"
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+)
+
+func RegisterAdminRoutes(router fiber.Router, db *gorm.DB) {
+	adminGroup := router.Group("/admin", middlewares.RequireAuth(), middlewares.DenyAPITokens(), middlewares.RequireVerifiedEmail())
+	controllers.RegisterAdminRoutes(adminGroup, db)
+}
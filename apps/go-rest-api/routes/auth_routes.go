@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/controllers"
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+)
+
+func RegisterAuthRoutes(router fiber.Router, db *gorm.DB) {
+	authGroup := router.Group("/auth", middlewares.Public())
+	controllers.RegisterAuthRoutes(authGroup, db)
+}
@@ -5,9 +5,10 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/spanhornet/brambles/apps/go-rest-api/controllers"
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
 )
 
 func RegisterChatRoutes(router fiber.Router, db *gorm.DB) {
-	chatGroup := router.Group("/chats")
+	chatGroup := router.Group("/chats", middlewares.RequireAuth())
 	controllers.RegisterChatRoutes(chatGroup, db)
 }
@@ -0,0 +1,13 @@
+package routes
+
+import (
+	"github.com/gofiber/fiber/v2"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/controllers"
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
+)
+
+func RegisterCSRFRoutes(router fiber.Router) {
+	csrfGroup := router.Group("/csrf", middlewares.Public())
+	controllers.RegisterCSRFRoutes(csrfGroup)
+}
@@ -3,10 +3,11 @@ package routes
 import (
 	"github.com/gofiber/fiber/v2"
 	"github.com/spanhornet/brambles/apps/go-rest-api/controllers"
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
 	"gorm.io/gorm"
 )
 
 func RegisterDocumentRoutes(router fiber.Router, db *gorm.DB) {
-	docsGroup := router.Group("/documents")
+	docsGroup := router.Group("/documents", middlewares.RequireAuth())
 	controllers.RegisterDocumentRoutes(docsGroup, db)
 }
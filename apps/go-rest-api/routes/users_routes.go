@@ -5,9 +5,32 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/spanhornet/brambles/apps/go-rest-api/controllers"
+	"github.com/spanhornet/brambles/apps/go-rest-api/middlewares"
 )
 
 func RegisterUserRoutes(router fiber.Router, db *gorm.DB) {
-	userGroup := router.Group("/users")
+	userGroup := router.Group("/users", middlewares.DenyAPITokens())
 	controllers.RegisterUserRoutes(userGroup, db)
+
+	// Credential and account management stays out of reach of impersonated sessions
+	phoneGroup := userGroup.Group("/phone", middlewares.RequireAuth(), middlewares.DenyImpersonation())
+	controllers.RegisterPhoneVerificationRoutes(phoneGroup, db)
+
+	sessionGroup := userGroup.Group("/me/sessions", middlewares.RequireAuth(), middlewares.DenyImpersonation())
+	controllers.RegisterSessionRoutes(sessionGroup, db)
+
+	tokenGroup := userGroup.Group("/me/tokens", middlewares.RequireAuth(), middlewares.DenyImpersonation())
+	controllers.RegisterAPITokenRoutes(tokenGroup, db)
+
+	exportGroup := userGroup.Group("/me/exports", middlewares.RequireAuth(), middlewares.DenyImpersonation())
+	controllers.RegisterDataExportRoutes(exportGroup, db)
+
+	twoFactorGroup := userGroup.Group("/2fa", middlewares.RequireAuth(), middlewares.DenyImpersonation())
+	controllers.RegisterTwoFactorRoutes(twoFactorGroup, db)
+
+	passkeyGroup := userGroup.Group("/passkeys")
+	controllers.RegisterPasskeyRoutes(passkeyGroup, db)
+
+	oidcGroup := userGroup.Group("/oidc", middlewares.Public())
+	controllers.RegisterOIDCRoutes(oidcGroup, db)
 }
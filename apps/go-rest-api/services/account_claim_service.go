@@ -0,0 +1,62 @@
+package services
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// ClaimUnverifiedAccount hands an account whose email was never verified to the person who
+// has just proven control of that address. Anyone can register an address they do not own,
+// so every credential the registrant could still hold is removed: the password, TOTP and
+// recovery codes, passkeys, linked sign-in providers, API tokens, sessions and outstanding
+// emailed tokens. The email is then marked as verified.
+func ClaimUnverifiedAccount(db *gorm.DB, userID uuid.UUID) error {
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Clear the password and second factor
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Updates(map[string]any{
+			"password":            "",
+			"totp_secret":         "",
+			"is_totp_enabled":     false,
+			"totp_last_used_step": 0,
+			"is_email_verified":   true,
+		}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		// Remove passkeys, provider identities and API tokens
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Credential{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.Identity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.APIToken{}).Error; err != nil {
+			return err
+		}
+
+		// Invalidate links sent on the registrant's behalf, such as email changes
+		if err := tx.Model(&models.VerificationToken{}).
+			Where("user_id = ? AND used_at IS NULL", userID).
+			Update("used_at", time.Now()).Error; err != nil {
+			return err
+		}
+
+		// Sign out everywhere
+		_, err := RevokeUserSessions(tx, userID)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	InvalidateUserSessionCache(context.Background(), userID)
+	return nil
+}
@@ -0,0 +1,276 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"log"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const defaultAccountDeletionGrace = 30 * 24 * time.Hour
+
+// AccountDeletionGrace is how long a scheduled deletion waits before the account is purged
+func AccountDeletionGrace() time.Duration {
+	if v := os.Getenv("ACCOUNT_DELETION_GRACE_HOURS"); v != "" {
+		if hours, err := strconv.Atoi(v); err == nil && hours >= 0 {
+			return time.Duration(hours) * time.Hour
+		}
+	}
+	return defaultAccountDeletionGrace
+}
+
+// ScheduleAccountDeletion marks the account for purging after the grace period and signs it out everywhere
+func ScheduleAccountDeletion(db *gorm.DB, userID uuid.UUID) (time.Time, error) {
+	now := time.Now()
+	scheduledAt := now.Add(AccountDeletionGrace())
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("id = ?", userID).Update("deletion_scheduled_at", scheduledAt).Error; err != nil {
+			return err
+		}
+		if _, err := RevokeUserSessions(tx, userID); err != nil {
+			return err
+		}
+		return tx.Model(&models.APIToken{}).
+			Where("user_id = ? AND revoked_at IS NULL", userID).
+			Update("revoked_at", now).Error
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	InvalidateUserSessionCache(context.Background(), userID)
+	return scheduledAt, nil
+}
+
+// CancelAccountDeletion clears a pending deletion, if any
+func CancelAccountDeletion(db *gorm.DB, userID uuid.UUID) error {
+	return db.Model(&models.User{}).
+		Where("id = ? AND deletion_scheduled_at IS NOT NULL", userID).
+		Update("deletion_scheduled_at", nil).Error
+}
+
+// ErrDeletionNotDue is returned by PurgeUser for an account that is not scheduled for deletion,
+// or whose grace period has not ended
+var ErrDeletionNotDue = errors.New("account deletion is not due")
+
+// PurgeUser removes every row that belongs to a user and then their stored objects, holding
+// the account's row so a sign-in cannot cancel the deletion halfway through. The objects are
+// queued as orphans in the same transaction and removed once it commits, so no bucket calls
+// are made under the lock; any that fail are retried by PurgeOrphanedObjects. Chats and
+// documents shared with an organization are handed to another member rather than removed.
+func PurgeUser(ctx context.Context, db *gorm.DB, userID uuid.UUID) error {
+	var orphans []models.OrphanedObject
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		// Lock the account and make sure the deletion is still due
+		var user models.User
+		err := tx.Unscoped().
+			Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND deletion_scheduled_at <= ?", userID, time.Now()).
+			First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrDeletionNotDue
+		}
+		if err != nil {
+			return err
+		}
+
+		// Keep shared chats and documents, with their messages, for the user's teammates
+		if err := reassignSharedContent(tx, userID); err != nil {
+			return err
+		}
+
+		// Collect the uploaded files and export archives
+		var documents []models.Document
+		if err := tx.Unscoped().Where("user_id = ?", userID).Find(&documents).Error; err != nil {
+			return err
+		}
+
+		var exports []models.DataExport
+		if err := tx.Where("user_id = ? AND object_key <> ''", userID).Find(&exports).Error; err != nil {
+			return err
+		}
+
+		// Queue them for removal, so they are not lost once their rows are gone
+		for _, document := range documents {
+			orphans = append(orphans, models.OrphanedObject{Bucket: document.Bucket, ObjectKey: document.ObjectKey})
+		}
+		for _, export := range exports {
+			orphans = append(orphans, models.OrphanedObject{Bucket: export.Bucket, ObjectKey: export.ObjectKey})
+		}
+		if len(orphans) > 0 {
+			if err := tx.Create(&orphans).Error; err != nil {
+				return err
+			}
+		}
+
+		// Remove the rows; tables with a foreign key to users cascade on their own
+		chats := tx.Unscoped().Model(&models.Chat{}).Select("id").Where("user_id = ?", userID)
+		if err := tx.Unscoped().Where("chat_id IN (?)", chats).Delete(&models.Message{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Document{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&models.Chat{}).Error; err != nil {
+			return err
+		}
+		return tx.Unscoped().Where("id = ?", userID).Delete(&models.User{}).Error
+	})
+	if err != nil {
+		return err
+	}
+
+	// Remove the objects now that the lock is released; failures stay queued
+	removeOrphanedObjects(ctx, db, orphans)
+	return nil
+}
+
+// removeOrphanedObjects removes queued objects from their buckets and drops them from the
+// queue, logging failures and returning how many were removed
+func removeOrphanedObjects(ctx context.Context, db *gorm.DB, orphans []models.OrphanedObject) int {
+	if len(orphans) == 0 {
+		return 0
+	}
+
+	client := GetCloudflareR2Client()
+	if client == nil {
+		log.Printf("error removing %d orphaned objects: Cloudflare R2 client not initialized", len(orphans))
+		return 0
+	}
+
+	removed := 0
+	for _, orphan := range orphans {
+		err := client.RemoveObject(ctx, orphan.Bucket, orphan.ObjectKey, minio.RemoveObjectOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			log.Printf("error removing orphaned object %s/%s: %v", orphan.Bucket, orphan.ObjectKey, err)
+			continue
+		}
+
+		if err := db.Delete(&orphan).Error; err != nil {
+			log.Printf("error clearing orphaned object %s: %v", orphan.ID, err)
+			continue
+		}
+		removed++
+	}
+
+	return removed
+}
+
+// PurgeOrphanedObjects retries the removal of every object still queued as an orphan
+func PurgeOrphanedObjects(ctx context.Context, db *gorm.DB) (int, error) {
+	var orphans []models.OrphanedObject
+	if err := db.Order("created_at").Find(&orphans).Error; err != nil {
+		return 0, err
+	}
+
+	return removeOrphanedObjects(ctx, db, orphans), nil
+}
+
+// reassignSharedContent moves the chats and documents a user shared with each organization to
+// its longest-standing owner, or failing that its most privileged member. Those of an
+// organization without other members stay with the user and are purged along with them.
+func reassignSharedContent(tx *gorm.DB, userID uuid.UUID) error {
+	var organizationIDs []uuid.UUID
+	err := tx.Raw(
+		"SELECT organization_id FROM chats WHERE user_id = ? AND organization_id IS NOT NULL UNION SELECT organization_id FROM documents WHERE user_id = ? AND organization_id IS NOT NULL",
+		userID, userID,
+	).Scan(&organizationIDs).Error
+	if err != nil {
+		return err
+	}
+
+	for _, organizationID := range organizationIDs {
+		var successors []uuid.UUID
+		err := tx.Model(&models.Membership{}).
+			Where("organization_id = ? AND user_id <> ?", organizationID, userID).
+			Clauses(clause.OrderBy{Expression: clause.Expr{
+				SQL:  "CASE role WHEN ? THEN 0 WHEN ? THEN 1 ELSE 2 END, created_at",
+				Vars: []any{models.MembershipRoleOwner, models.MembershipRoleAdmin},
+			}}).
+			Limit(1).
+			Pluck("user_id", &successors).Error
+		if err != nil {
+			return err
+		}
+		if len(successors) == 0 {
+			continue
+		}
+
+		for _, model := range []any{&models.Chat{}, &models.Document{}} {
+			if err := tx.Unscoped().Model(model).
+				Where("user_id = ? AND organization_id = ?", userID, organizationID).
+				Update("user_id", successors[0]).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// PurgeScheduledAccounts purges every account whose grace period has ended
+func PurgeScheduledAccounts(ctx context.Context, db *gorm.DB) (int, error) {
+	var userIDs []uuid.UUID
+	err := db.Unscoped().Model(&models.User{}).
+		Where("deletion_scheduled_at <= ?", time.Now()).
+		Pluck("id", &userIDs).Error
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, userID := range userIDs {
+		err := PurgeUser(ctx, db, userID)
+		if errors.Is(err, ErrDeletionNotDue) {
+			// Cancelled by a sign-in since it was selected
+			continue
+		}
+		if err != nil {
+			log.Printf("error purging user %s: %v", userID, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// StartAccountPurger runs PurgeScheduledAccounts, then retries orphaned objects, on an interval
+// until the context is cancelled
+func StartAccountPurger(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if purged, err := PurgeScheduledAccounts(ctx, db); err != nil {
+				log.Printf("error purging scheduled accounts: %v", err)
+			} else if purged > 0 {
+				log.Printf("purged %d scheduled accounts", purged)
+			}
+
+			if removed, err := PurgeOrphanedObjects(ctx, db); err != nil {
+				log.Printf("error purging orphaned objects: %v", err)
+			} else if removed > 0 {
+				log.Printf("removed %d orphaned objects", removed)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
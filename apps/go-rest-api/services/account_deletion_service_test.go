@@ -0,0 +1,176 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/internal/testdb"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func TestPurgeUserRequiresDueDeletion(t *testing.T) {
+	db := testdb.Open(t)
+
+	past, future := time.Now().Add(-time.Minute), time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name        string
+		scheduledAt *time.Time
+		wantErr     error
+	}{
+		{name: "grace period over", scheduledAt: &past},
+		{name: "grace period running", scheduledAt: &future, wantErr: ErrDeletionNotDue},
+		{name: "deletion cancelled", scheduledAt: nil, wantErr: ErrDeletionNotDue},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testdb.CreateUser(t, db, models.User{DeletionScheduledAt: tt.scheduledAt})
+
+			if err := PurgeUser(context.Background(), db, user.ID); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+
+			var users int64
+			if err := db.Unscoped().Model(&models.User{}).Where("id = ?", user.ID).Count(&users).Error; err != nil {
+				t.Fatal(err)
+			}
+			if purged := users == 0; purged != (tt.wantErr == nil) {
+				t.Errorf("purged = %v, want %v", purged, tt.wantErr == nil)
+			}
+		})
+	}
+}
+
+func TestPurgeUserKeepsSharedChats(t *testing.T) {
+	db := testdb.Open(t)
+
+	tests := []struct {
+		name string
+		// teammateRole is the role of the organization's other member, if any
+		teammateRole string
+		wantKept     bool
+	}{
+		{name: "owner takes over", teammateRole: models.MembershipRoleOwner, wantKept: true},
+		{name: "member takes over", teammateRole: models.MembershipRoleMember, wantKept: true},
+		{name: "organization without other members", wantKept: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			due := time.Now().Add(-time.Minute)
+			user := testdb.CreateUser(t, db, models.User{DeletionScheduledAt: &due})
+
+			organization, err := CreateOrganization(db, user.ID, "Team")
+			if err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { db.Unscoped().Delete(&models.Organization{}, "id = ?", organization.ID) })
+
+			teammate := testdb.CreateUser(t, db, models.User{})
+			if tt.teammateRole != "" {
+				if err := db.Create(&models.Membership{OrganizationID: organization.ID, UserID: teammate.ID, Role: tt.teammateRole}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			personal := models.Chat{UserID: user.ID, Name: "personal"}
+			shared := models.Chat{UserID: user.ID, OrganizationID: &organization.ID, Name: "shared"}
+			for _, chat := range []*models.Chat{&personal, &shared} {
+				if err := db.Create(chat).Error; err != nil {
+					t.Fatal(err)
+				}
+				if err := db.Create(&models.Message{ChatID: chat.ID, Role: "user", Content: "hello"}).Error; err != nil {
+					t.Fatal(err)
+				}
+			}
+			t.Cleanup(func() { db.Unscoped().Delete(&models.Chat{}, "id IN ?", []any{personal.ID, shared.ID}) })
+
+			if err := PurgeUser(context.Background(), db, user.ID); err != nil {
+				t.Fatal(err)
+			}
+
+			var chats []models.Chat
+			if err := db.Unscoped().Where("id IN ?", []any{personal.ID, shared.ID}).Find(&chats).Error; err != nil {
+				t.Fatal(err)
+			}
+
+			var kept *models.Chat
+			for i := range chats {
+				if chats[i].ID == personal.ID {
+					t.Error("personal chat was kept")
+				}
+				if chats[i].ID == shared.ID {
+					kept = &chats[i]
+				}
+			}
+			if (kept != nil) != tt.wantKept {
+				t.Fatalf("shared chat kept = %v, want %v", kept != nil, tt.wantKept)
+			}
+			if kept == nil {
+				return
+			}
+
+			if kept.UserID != teammate.ID {
+				t.Errorf("shared chat owner = %s, want %s", kept.UserID, teammate.ID)
+			}
+
+			var messages int64
+			if err := db.Model(&models.Message{}).Where("chat_id = ?", shared.ID).Count(&messages).Error; err != nil {
+				t.Fatal(err)
+			}
+			if messages != 1 {
+				t.Errorf("shared chat has %d messages, want 1", messages)
+			}
+		})
+	}
+}
+
+func TestPurgeUserQueuesObjectsAfterDeletingRows(t *testing.T) {
+	db := testdb.Open(t)
+
+	due := time.Now().Add(-time.Minute)
+	user := testdb.CreateUser(t, db, models.User{DeletionScheduledAt: &due})
+
+	chat := models.Chat{UserID: user.ID, Name: "personal"}
+	if err := db.Create(&chat).Error; err != nil {
+		t.Fatal(err)
+	}
+	document := models.Document{
+		UserID:    user.ID,
+		ChatID:    chat.ID,
+		Bucket:    "documents",
+		ObjectKey: "purge-test/" + user.ID.String(),
+		URL:       "https://example.com/document.pdf",
+		FileName:  "document.pdf",
+		FileSize:  1,
+		MimeType:  "application/pdf",
+	}
+	if err := db.Create(&document).Error; err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Where("object_key = ?", document.ObjectKey).Delete(&models.OrphanedObject{}) })
+
+	// Without a bucket client the removal fails, which must not keep the rows around
+	if err := PurgeUser(context.Background(), db, user.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	var documents int64
+	if err := db.Unscoped().Model(&models.Document{}).Where("id = ?", document.ID).Count(&documents).Error; err != nil {
+		t.Fatal(err)
+	}
+	if documents != 0 {
+		t.Error("document row was kept")
+	}
+
+	var orphans []models.OrphanedObject
+	if err := db.Where("object_key = ?", document.ObjectKey).Find(&orphans).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(orphans) != 1 || orphans[0].Bucket != document.Bucket {
+		t.Errorf("orphaned objects = %+v, want the document's object queued once", orphans)
+	}
+}
@@ -0,0 +1,84 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	APITokenPrefix          = "brb_pat_"
+	apiTokenLastUsedLatency = time.Minute
+)
+
+// ErrAPITokenNotFound is returned for unknown, expired or revoked API tokens
+var ErrAPITokenNotFound = errors.New("API token not found")
+
+// IsAPIToken reports whether a bearer credential is a personal access token rather than a session token
+func IsAPIToken(token string) bool {
+	return strings.HasPrefix(token, APITokenPrefix)
+}
+
+// CreateAPIToken stores a new API token and returns the raw token, which is shown to the user only once
+func CreateAPIToken(db *gorm.DB, userID uuid.UUID, name string, scopes []string, expiresAt *time.Time) (string, models.APIToken, error) {
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", models.APIToken{}, err
+	}
+	token := APITokenPrefix + secret
+
+	record := models.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    token[:len(APITokenPrefix)+4],
+		TokenHash: HashToken(token),
+		Scopes:    scopes,
+		ExpiresAt: expiresAt,
+	}
+	if err := db.Create(&record).Error; err != nil {
+		return "", models.APIToken{}, err
+	}
+
+	return token, record, nil
+}
+
+// FindAPIToken looks up an active API token and its user, recording when it was last used
+func FindAPIToken(db *gorm.DB, token string) (models.APIToken, error) {
+	var record models.APIToken
+
+	now := time.Now()
+	err := db.
+		Preload("User").
+		Where("token_hash = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", HashToken(token), now).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrAPITokenNotFound
+	}
+	if err != nil {
+		return record, err
+	}
+
+	// Throttle last-used writes
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > apiTokenLastUsedLatency {
+		_ = db.Model(&models.APIToken{}).Where("id = ?", record.ID).UpdateColumn("last_used_at", now).Error
+		record.LastUsedAt = &now
+	}
+
+	return record, nil
+}
+
+// HasScopes reports whether an API token grants every one of the given scopes
+func HasScopes(record models.APIToken, scopes ...string) bool {
+	for _, scope := range scopes {
+		if !slices.Contains(record.Scopes, scope) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,17 @@
+package services
+
+import (
+	"log"
+
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// RecordAuditEvent stores an audit event. Failing to record never fails the request it
+// describes, so errors are logged rather than returned.
+func RecordAuditEvent(db *gorm.DB, event models.AuditEvent) {
+	if err := db.Create(&event).Error; err != nil {
+		log.Printf("error recording audit event %s: %v", event.Action, err)
+	}
+}
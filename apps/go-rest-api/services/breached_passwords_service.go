@@ -0,0 +1,168 @@
+package services
+
+import (
+	"bufio"
+	"container/list"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	breachedPrefixLength     = 5
+	defaultBreachedCacheSize = 256
+)
+
+var (
+	breachedPasswordsDir string
+	breachedRanges       *breachedRangeCache
+)
+
+// InitBreachedPasswords points breached-password checks at BREACHED_PASSWORDS_DIR. The
+// directory is laid out like the k-anonymity range API: one file per five-character SHA-1
+// prefix, named <PREFIX> or <PREFIX>.txt, listing the remaining 35 characters of each digest
+// as SUFFIX or SUFFIX:COUNT lines. Only the file for a candidate's prefix is read, and the
+// BREACHED_PASSWORDS_CACHE_SIZE most recently read ranges are kept in memory. Without a
+// directory no password is treated as breached.
+func InitBreachedPasswords() error {
+	dir := os.Getenv("BREACHED_PASSWORDS_DIR")
+	if dir == "" {
+		return nil
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("%s is not a directory", dir)
+	}
+
+	size := defaultBreachedCacheSize
+	if v := os.Getenv("BREACHED_PASSWORDS_CACHE_SIZE"); v != "" {
+		if size, err = strconv.Atoi(v); err != nil || size < 0 {
+			return fmt.Errorf("invalid BREACHED_PASSWORDS_CACHE_SIZE: %q", v)
+		}
+	}
+
+	breachedPasswordsDir = dir
+	breachedRanges = newBreachedRangeCache(size)
+	return nil
+}
+
+// BreachedPasswordsEnabled reports whether a corpus directory is configured
+func BreachedPasswordsEnabled() bool {
+	return breachedPasswordsDir != ""
+}
+
+// IsBreachedPassword reports whether the password appears in the corpus. A range that cannot
+// be read is logged and treated as clean, so a damaged corpus does not block every password.
+func IsBreachedPassword(password string) bool {
+	if breachedPasswordsDir == "" {
+		return false
+	}
+
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:breachedPrefixLength], digest[breachedPrefixLength:]
+
+	suffixes, err := breachedRanges.get(prefix, func() (map[string]struct{}, error) {
+		return loadBreachedRange(breachedPasswordsDir, prefix)
+	})
+	if err != nil {
+		log.Printf("error reading breached password range %s: %v", prefix, err)
+		return false
+	}
+
+	_, ok := suffixes[suffix]
+	return ok
+}
+
+// loadBreachedRange reads the suffixes listed for a prefix; a missing file is an empty range
+func loadBreachedRange(dir string, prefix string) (map[string]struct{}, error) {
+	var file *os.File
+	for _, name := range []string{prefix, prefix + ".txt", strings.ToLower(prefix), strings.ToLower(prefix) + ".txt"} {
+		f, err := os.Open(filepath.Join(dir, name))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		file = f
+		break
+	}
+
+	suffixes := map[string]struct{}{}
+	if file == nil {
+		return suffixes, nil
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		suffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if suffix != "" {
+			suffixes[strings.ToUpper(suffix)] = struct{}{}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return suffixes, nil
+}
+
+// breachedRangeCache keeps the most recently read ranges, evicting the least recently used
+type breachedRangeCache struct {
+	mu      sync.Mutex
+	size    int
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+type breachedRangeEntry struct {
+	prefix   string
+	suffixes map[string]struct{}
+}
+
+func newBreachedRangeCache(size int) *breachedRangeCache {
+	return &breachedRangeCache{size: size, order: list.New(), entries: map[string]*list.Element{}}
+}
+
+func (c *breachedRangeCache) get(prefix string, load func() (map[string]struct{}, error)) (map[string]struct{}, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[prefix]; ok {
+		c.order.MoveToFront(e)
+		c.mu.Unlock()
+		return e.Value.(*breachedRangeEntry).suffixes, nil
+	}
+	c.mu.Unlock()
+
+	suffixes, err := load()
+	if err != nil || c.size == 0 {
+		return suffixes, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.entries[prefix]; !ok {
+		c.entries[prefix] = c.order.PushFront(&breachedRangeEntry{prefix: prefix, suffixes: suffixes})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*breachedRangeEntry).prefix)
+		}
+	}
+
+	return suffixes, nil
+}
@@ -0,0 +1,73 @@
+package services
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writeBreachedRange adds a password to a corpus directory in the range file layout
+func writeBreachedRange(t *testing.T, dir string, name func(prefix string) string, password string) {
+	t.Helper()
+
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+
+	f, err := os.OpenFile(filepath.Join(dir, name(digest[:5])), os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	if _, err := f.WriteString(digest[5:] + ":42\n"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIsBreachedPassword(t *testing.T) {
+	dir := t.TempDir()
+	writeBreachedRange(t, dir, func(p string) string { return p }, "hunter2hunter2")
+	writeBreachedRange(t, dir, func(p string) string { return p + ".txt" }, "Summer2024!")
+	writeBreachedRange(t, dir, func(p string) string { return strings.ToLower(p) + ".txt" }, "correcthorse9")
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{"hunter2hunter2", true},
+		{"Summer2024!", true},
+		{"correcthorse9", true},
+		{"Hunter2hunter2", false},
+		{"a fresh passphrase nobody has leaked", false},
+	}
+
+	// A one-entry cache forces evictions between lookups
+	for _, cacheSize := range []string{"0", "1", "256"} {
+		t.Run("cache "+cacheSize, func(t *testing.T) {
+			t.Setenv("BREACHED_PASSWORDS_DIR", dir)
+			t.Setenv("BREACHED_PASSWORDS_CACHE_SIZE", cacheSize)
+			if err := InitBreachedPasswords(); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() { breachedPasswordsDir, breachedRanges = "", nil })
+
+			for range 2 {
+				for _, tt := range tests {
+					if got := IsBreachedPassword(tt.password); got != tt.want {
+						t.Errorf("IsBreachedPassword(%q) = %v, want %v", tt.password, got, tt.want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestInitBreachedPasswordsRequiresDirectory(t *testing.T) {
+	t.Setenv("BREACHED_PASSWORDS_DIR", filepath.Join(t.TempDir(), "missing"))
+	if err := InitBreachedPasswords(); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
@@ -0,0 +1,32 @@
+package services
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"sync"
+)
+
+const csrfSecretVariable = "CSRF_SECRET"
+
+// csrfSecret keys CSRF tokens. Without CSRF_SECRET a random key is used, so tokens change when
+// the process restarts and differ between instances.
+var csrfSecret = sync.OnceValue(func() []byte {
+	if secret := os.Getenv(csrfSecretVariable); secret != "" {
+		return []byte(secret)
+	}
+
+	secret := make([]byte, sha256.Size)
+	rand.Read(secret)
+	return secret
+})
+
+// CSRFToken derives the CSRF token bound to a session from the session's token digest. Only
+// the server can compute it, so a cookie planted by a sibling subdomain cannot forge one.
+func CSRFToken(sessionDigest string) string {
+	mac := hmac.New(sha256.New, csrfSecret())
+	mac.Write([]byte("csrf:" + sessionDigest))
+	return hex.EncodeToString(mac.Sum(nil))
+}
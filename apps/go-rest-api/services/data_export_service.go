@@ -0,0 +1,348 @@
+package services
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/minio/minio-go/v7"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	// DataExportRetention is how long a finished archive can be downloaded
+	DataExportRetention = 7 * 24 * time.Hour
+	// DataExportLinkTTL is how long a presigned download link stays valid
+	DataExportLinkTTL = 15 * time.Minute
+
+	dataExportTimeout = 30 * time.Minute
+)
+
+// dataExportManifestFile describes one entry of the archive
+type dataExportManifestFile struct {
+	Path        string `json:"path"`
+	Description string `json:"description"`
+	Size        int64  `json:"size"`
+}
+
+// dataExportManifest is written to manifest.json at the root of the archive
+type dataExportManifest struct {
+	ExportID    uuid.UUID                `json:"exportId"`
+	UserID      uuid.UUID                `json:"userId"`
+	GeneratedAt time.Time                `json:"generatedAt"`
+	Files       []dataExportManifestFile `json:"files"`
+}
+
+// StartDataExport records a pending export and builds the archive in the background
+func StartDataExport(db *gorm.DB, userID uuid.UUID) (models.DataExport, error) {
+	export := models.DataExport{
+		UserID: userID,
+		Status: models.DataExportStatusPending,
+	}
+	if err := db.Create(&export).Error; err != nil {
+		return models.DataExport{}, err
+	}
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), dataExportTimeout)
+		defer cancel()
+
+		if err := runDataExport(ctx, db, export); err != nil {
+			log.Printf("error building data export %s: %v", export.ID, err)
+			db.Model(&export).Updates(map[string]any{
+				"status": models.DataExportStatusFailed,
+				"error":  err.Error(),
+			})
+		}
+	}()
+
+	return export, nil
+}
+
+// runDataExport builds the archive in a temporary file and uploads it to the bucket
+func runDataExport(ctx context.Context, db *gorm.DB, export models.DataExport) error {
+	client := GetCloudflareR2Client()
+	if client == nil {
+		return errors.New("Cloudflare R2 client not initialized")
+	}
+	bucket := os.Getenv("CLOUDFLARE_R2_BUCKET_NAME")
+	if bucket == "" {
+		return errors.New("R2 bucket name not configured")
+	}
+
+	if err := db.Model(&export).Update("status", models.DataExportStatusRunning).Error; err != nil {
+		return err
+	}
+
+	// Write the archive
+	file, err := os.CreateTemp("", "data-export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if err := writeDataExport(ctx, db, client, export, file); err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	// Upload the archive
+	objectKey := fmt.Sprintf("exports/%s/%s.zip", export.UserID, export.ID)
+	_, err = client.PutObject(ctx, bucket, objectKey, file, info.Size(), minio.PutObjectOptions{
+		ContentType: "application/zip",
+	})
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	return db.Model(&export).Updates(map[string]any{
+		"status":       models.DataExportStatusCompleted,
+		"bucket":       bucket,
+		"object_key":   objectKey,
+		"size":         info.Size(),
+		"completed_at": now,
+		"expires_at":   now.Add(DataExportRetention),
+	}).Error
+}
+
+// writeDataExport gathers the user's data into a zip archive
+func writeDataExport(ctx context.Context, db *gorm.DB, client *minio.Client, export models.DataExport, w io.Writer) error {
+	var user models.User
+	if err := db.First(&user, "id = ?", export.UserID).Error; err != nil {
+		return err
+	}
+
+	var chats []models.Chat
+	if err := db.Preload("Messages", func(tx *gorm.DB) *gorm.DB {
+		return tx.Order("created_at ASC")
+	}).Where("user_id = ?", user.ID).Order("created_at ASC").Find(&chats).Error; err != nil {
+		return err
+	}
+
+	var sessions []models.Session
+	if err := db.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&sessions).Error; err != nil {
+		return err
+	}
+
+	var documents []models.Document
+	if err := db.Where("user_id = ?", user.ID).Order("created_at ASC").Find(&documents).Error; err != nil {
+		return err
+	}
+
+	archive := zip.NewWriter(w)
+	manifest := dataExportManifest{
+		ExportID:    export.ID,
+		UserID:      user.ID,
+		GeneratedAt: time.Now(),
+	}
+
+	// addJSON writes one JSON document to the archive and records it in the manifest
+	addJSON := func(name string, description string, value any) error {
+		data, err := json.MarshalIndent(value, "", "  ")
+		if err != nil {
+			return err
+		}
+		entry, err := archive.Create(name)
+		if err != nil {
+			return err
+		}
+		if _, err := entry.Write(data); err != nil {
+			return err
+		}
+		manifest.Files = append(manifest.Files, dataExportManifestFile{Path: name, Description: description, Size: int64(len(data))})
+		return nil
+	}
+
+	if err := addJSON("profile.json", "account profile", map[string]any{
+		"id":              user.ID,
+		"createdAt":       user.CreatedAt,
+		"updatedAt":       user.UpdatedAt,
+		"firstName":       user.FirstName,
+		"lastName":        user.LastName,
+		"email":           user.Email,
+		"isEmailVerified": user.IsEmailVerified,
+		"phone":           user.Phone,
+		"isPhoneVerified": user.IsPhoneVerified,
+		"isTotpEnabled":   user.IsTOTPEnabled,
+	}); err != nil {
+		return err
+	}
+
+	chatEntries := make([]map[string]any, 0, len(chats))
+	for _, chat := range chats {
+		messages := make([]map[string]any, 0, len(chat.Messages))
+		for _, message := range chat.Messages {
+			messages = append(messages, map[string]any{
+				"id":        message.ID,
+				"createdAt": message.CreatedAt,
+				"role":      message.Role,
+				"model":     message.Model,
+				"content":   message.Content,
+			})
+		}
+		chatEntries = append(chatEntries, map[string]any{
+			"id":        chat.ID,
+			"createdAt": chat.CreatedAt,
+			"updatedAt": chat.UpdatedAt,
+			"name":      chat.Name,
+			"messages":  messages,
+		})
+	}
+	if err := addJSON("chats.json", "chats and their messages", chatEntries); err != nil {
+		return err
+	}
+
+	sessionEntries := make([]map[string]any, 0, len(sessions))
+	for _, session := range sessions {
+		sessionEntries = append(sessionEntries, map[string]any{
+			"id":        session.ID,
+			"createdAt": session.CreatedAt,
+			"expiresAt": session.ExpiresAt,
+			"updatedAt": session.UpdatedAt,
+			"ipAddress": session.IPAddress,
+			"userAgent": session.UserAgent,
+		})
+	}
+	if err := addJSON("sessions.json", "sign-in sessions", sessionEntries); err != nil {
+		return err
+	}
+
+	documentEntries := make([]map[string]any, 0, len(documents))
+	for _, document := range documents {
+		name := path.Join("documents", document.ID.String(), path.Base(document.FileName))
+		documentEntries = append(documentEntries, map[string]any{
+			"id":        document.ID,
+			"chatId":    document.ChatID,
+			"createdAt": document.CreatedAt,
+			"fileName":  document.FileName,
+			"fileSize":  document.FileSize,
+			"mimeType":  document.MimeType,
+			"path":      name,
+		})
+
+		// Copy the original file
+		object, err := client.GetObject(ctx, document.Bucket, document.ObjectKey, minio.GetObjectOptions{})
+		if err != nil {
+			return err
+		}
+		entry, err := archive.Create(name)
+		if err != nil {
+			object.Close()
+			return err
+		}
+		size, err := io.Copy(entry, object)
+		object.Close()
+		if err != nil {
+			return fmt.Errorf("copying document %s: %w", document.ID, err)
+		}
+		manifest.Files = append(manifest.Files, dataExportManifestFile{Path: name, Description: "uploaded file", Size: size})
+	}
+	if err := addJSON("documents.json", "uploaded file metadata", documentEntries); err != nil {
+		return err
+	}
+
+	// The manifest goes last so that it lists every other file
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	entry, err := archive.Create("manifest.json")
+	if err != nil {
+		return err
+	}
+	if _, err := entry.Write(data); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// DataExportDownloadURL returns a short-lived link to a completed archive
+func DataExportDownloadURL(ctx context.Context, export models.DataExport) (string, time.Time, error) {
+	client := GetCloudflareR2Client()
+	if client == nil {
+		return "", time.Time{}, errors.New("Cloudflare R2 client not initialized")
+	}
+
+	link, err := client.PresignedGetObject(ctx, export.Bucket, export.ObjectKey, DataExportLinkTTL, nil)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return link.String(), time.Now().Add(DataExportLinkTTL), nil
+}
+
+// PurgeExpiredDataExports removes the archives of expired exports from the bucket and clears
+// their object keys, keeping the rows as a record of the export
+func PurgeExpiredDataExports(ctx context.Context, db *gorm.DB) (int, error) {
+	var exports []models.DataExport
+	err := db.
+		Where("expires_at <= ? AND object_key <> ''", time.Now()).
+		Find(&exports).Error
+	if err != nil || len(exports) == 0 {
+		return 0, err
+	}
+
+	client := GetCloudflareR2Client()
+	if client == nil {
+		return 0, errors.New("Cloudflare R2 client not initialized")
+	}
+
+	purged := 0
+	for _, export := range exports {
+		err := client.RemoveObject(ctx, export.Bucket, export.ObjectKey, minio.RemoveObjectOptions{})
+		if err != nil && minio.ToErrorResponse(err).Code != "NoSuchKey" {
+			log.Printf("error removing data export %s: %v", export.ID, err)
+			continue
+		}
+
+		if err := db.Model(&export).Update("object_key", "").Error; err != nil {
+			log.Printf("error clearing data export %s: %v", export.ID, err)
+			continue
+		}
+		purged++
+	}
+
+	return purged, nil
+}
+
+// StartDataExportSweeper runs PurgeExpiredDataExports on an interval until the context is cancelled
+func StartDataExportSweeper(ctx context.Context, db *gorm.DB, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			if purged, err := PurgeExpiredDataExports(ctx, db); err != nil {
+				log.Printf("error purging expired data exports: %v", err)
+			} else if purged > 0 {
+				log.Printf("purged %d expired data exports", purged)
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,206 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const AccessTokenTTL = 15 * time.Minute
+
+var ErrInvalidAccessToken = errors.New("invalid access token")
+
+// signingKey is an ES256 key identified in token headers by its key ID
+type signingKey struct {
+	ID         string
+	PrivateKey *ecdsa.PrivateKey
+}
+
+var (
+	jwtKeys   []signingKey
+	jwtIssuer string
+)
+
+// AccessClaims are the claims of an access token
+type AccessClaims struct {
+	SessionID uuid.UUID `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// InitJWTKeys loads the access token signing keys. Each PEM file in JWT_SIGNING_KEYS_DIR holds
+// one EC P-256 private key named <kid>.pem. The last key by name signs new tokens while every
+// key stays published in the JWKS, so keys rotate by adding a newer file and removing the
+// oldest once its tokens have expired. Without a directory an ephemeral key is generated.
+func InitJWTKeys() error {
+	jwtIssuer = os.Getenv("JWT_ISSUER")
+	if jwtIssuer == "" {
+		jwtIssuer = "brambles"
+	}
+
+	dir := os.Getenv("JWT_SIGNING_KEYS_DIR")
+	if dir == "" {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		log.Println("JWT_SIGNING_KEYS_DIR is not set, access tokens will not survive a restart")
+		jwtKeys = []signingKey{{ID: "ephemeral-" + uuid.NewString()[:8], PrivateKey: key}}
+		return nil
+	}
+
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return fmt.Errorf("no signing keys found in %s", dir)
+	}
+	slices.Sort(paths)
+
+	keys := make([]signingKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		key, err := parseECPrivateKey(data)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		keys = append(keys, signingKey{
+			ID:         strings.TrimSuffix(filepath.Base(path), ".pem"),
+			PrivateKey: key,
+		})
+	}
+
+	jwtKeys = keys
+	return nil
+}
+
+// parseECPrivateKey reads a P-256 key in either SEC 1 or PKCS #8 form
+func parseECPrivateKey(data []byte) (*ecdsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block")
+	}
+
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return checkP256(key)
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := parsed.(*ecdsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("not an EC private key")
+	}
+	return checkP256(key)
+}
+
+func checkP256(key *ecdsa.PrivateKey) (*ecdsa.PrivateKey, error) {
+	if key.Curve != elliptic.P256() {
+		return nil, errors.New("key is not on the P-256 curve")
+	}
+	return key, nil
+}
+
+// IsAccessToken reports whether a bearer credential is a JWT rather than an opaque token
+func IsAccessToken(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// IssueAccessToken signs a short-lived access token for a user's session
+func IssueAccessToken(userID uuid.UUID, sessionID uuid.UUID) (string, time.Time, error) {
+	if len(jwtKeys) == 0 {
+		return "", time.Time{}, errors.New("JWT keys not initialized")
+	}
+	key := jwtKeys[len(jwtKeys)-1]
+
+	now := time.Now()
+	expiresAt := now.Add(AccessTokenTTL)
+
+	token := jwt.NewWithClaims(jwt.SigningMethodES256, AccessClaims{
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    jwtIssuer,
+			Subject:   userID.String(),
+			IssuedAt:  jwt.NewNumericDate(now),
+			NotBefore: jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+			ID:        uuid.NewString(),
+		},
+	})
+	token.Header["kid"] = key.ID
+
+	signed, err := token.SignedString(key.PrivateKey)
+	if err != nil {
+		return "", time.Time{}, err
+	}
+
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies an access token's signature, issuer and lifetime
+func ParseAccessToken(token string) (AccessClaims, error) {
+	var claims AccessClaims
+
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		for _, key := range jwtKeys {
+			if key.ID == kid {
+				return &key.PrivateKey.PublicKey, nil
+			}
+		}
+		return nil, errors.New("unknown key ID")
+	},
+		jwt.WithValidMethods([]string{jwt.SigningMethodES256.Alg()}),
+		jwt.WithIssuer(jwtIssuer),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		return claims, ErrInvalidAccessToken
+	}
+
+	return claims, nil
+}
+
+// JWKS returns the public signing keys as a JSON Web Key Set
+func JWKS() map[string]any {
+	keys := make([]map[string]any, 0, len(jwtKeys))
+	for _, key := range jwtKeys {
+		keys = append(keys, map[string]any{
+			"kty": "EC",
+			"crv": "P-256",
+			"use": "sig",
+			"alg": jwt.SigningMethodES256.Alg(),
+			"kid": key.ID,
+			"x":   encodeCoordinate(key.PrivateKey.X),
+			"y":   encodeCoordinate(key.PrivateKey.Y),
+		})
+	}
+	return map[string]any{"keys": keys}
+}
+
+// encodeCoordinate encodes a P-256 coordinate as 32 big-endian bytes in base64url
+func encodeCoordinate(n *big.Int) string {
+	b := make([]byte, 32)
+	n.FillBytes(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
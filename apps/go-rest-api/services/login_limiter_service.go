@@ -0,0 +1,227 @@
+package services
+
+import (
+	"context"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LoginThrottlePolicy describes how failed sign-ins against one key lead to lockouts.
+// After FreeAttempts failures within Window, each further failure locks the key for
+// BaseLockout, doubling per failure up to MaxLockout.
+type LoginThrottlePolicy struct {
+	FreeAttempts int
+	BaseLockout  time.Duration
+	MaxLockout   time.Duration
+	Window       time.Duration
+}
+
+var (
+	EmailLoginPolicy = LoginThrottlePolicy{FreeAttempts: 5, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: 24 * time.Hour}
+	IPLoginPolicy    = LoginThrottlePolicy{FreeAttempts: 20, BaseLockout: 30 * time.Second, MaxLockout: time.Hour, Window: time.Hour}
+
+	// Magic link policies count every request, since each one mails a sign-in credential
+	EmailMagicLinkPolicy = LoginThrottlePolicy{FreeAttempts: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+	IPMagicLinkPolicy    = LoginThrottlePolicy{FreeAttempts: 10, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+
+	// Password reset policies likewise count every request, since each one sends an email
+	EmailPasswordResetPolicy = LoginThrottlePolicy{FreeAttempts: 3, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+	IPPasswordResetPolicy    = LoginThrottlePolicy{FreeAttempts: 10, BaseLockout: time.Minute, MaxLockout: time.Hour, Window: time.Hour}
+)
+
+// lockoutFor returns how long a key is locked after its nth failure
+func (p LoginThrottlePolicy) lockoutFor(failures int64) time.Duration {
+	excess := failures - int64(p.FreeAttempts)
+	if excess <= 0 {
+		return 0
+	}
+
+	lockout := float64(p.BaseLockout) * math.Pow(2, float64(excess-1))
+	if lockout > float64(p.MaxLockout) {
+		return p.MaxLockout
+	}
+	return time.Duration(lockout)
+}
+
+// LoginEmailKey identifies sign-in attempts against an account
+func LoginEmailKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// LoginIPKey identifies sign-in attempts from a client address
+func LoginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// MagicLinkEmailKey identifies magic link requests for an address
+func MagicLinkEmailKey(email string) string {
+	return "magic_link_email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// MagicLinkIPKey identifies magic link requests from a client address
+func MagicLinkIPKey(ip string) string {
+	return "magic_link_ip:" + ip
+}
+
+// PasswordResetEmailKey identifies password reset requests for an address
+func PasswordResetEmailKey(email string) string {
+	return "password_reset_email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+// PasswordResetIPKey identifies password reset requests from a client address
+func PasswordResetIPKey(ip string) string {
+	return "password_reset_ip:" + ip
+}
+
+// LoginLimiter tracks failed sign-ins and locks out keys that fail too often
+type LoginLimiter interface {
+	// LockedFor returns how long the key remains locked, or zero if it is not locked
+	LockedFor(ctx context.Context, key string) (time.Duration, error)
+	// RecordFailure counts a failed sign-in and returns the resulting lockout, if any
+	RecordFailure(ctx context.Context, key string, policy LoginThrottlePolicy) (time.Duration, error)
+	// Reset clears the failures and any lockout for the key
+	Reset(ctx context.Context, key string) error
+}
+
+// RedisLoginLimiter keeps counters in Redis so lockouts apply across instances
+type RedisLoginLimiter struct {
+	Client *redis.Client
+}
+
+func redisLoginKey(key string) string {
+	return "login_attempts:" + key
+}
+
+func (l *RedisLoginLimiter) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	lockedUntil, err := l.Client.HGet(ctx, redisLoginKey(key), "locked_until").Int64()
+	if err == redis.Nil {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return max(time.Until(time.Unix(lockedUntil, 0)), 0), nil
+}
+
+func (l *RedisLoginLimiter) RecordFailure(ctx context.Context, key string, policy LoginThrottlePolicy) (time.Duration, error) {
+	k := redisLoginKey(key)
+
+	failures, err := l.Client.HIncrBy(ctx, k, "failures", 1).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	lockout := policy.lockoutFor(failures)
+	_, err = l.Client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		if lockout > 0 {
+			pipe.HSet(ctx, k, "locked_until", time.Now().Add(lockout).Unix())
+		}
+		pipe.Expire(ctx, k, max(policy.Window, lockout))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return lockout, nil
+}
+
+func (l *RedisLoginLimiter) Reset(ctx context.Context, key string) error {
+	return l.Client.Del(ctx, redisLoginKey(key)).Err()
+}
+
+// MemoryLoginLimiter keeps counters in process memory, for tests and local development
+type MemoryLoginLimiter struct {
+	mu      sync.Mutex
+	entries map[string]*memoryLoginEntry
+}
+
+type memoryLoginEntry struct {
+	failures    int64
+	lockedUntil time.Time
+	expiresAt   time.Time
+}
+
+func NewMemoryLoginLimiter() *MemoryLoginLimiter {
+	return &MemoryLoginLimiter{entries: map[string]*memoryLoginEntry{}}
+}
+
+// entry returns the live entry for a key, dropping it once its window has passed
+func (l *MemoryLoginLimiter) entry(key string, now time.Time) *memoryLoginEntry {
+	e, ok := l.entries[key]
+	if ok && now.After(e.expiresAt) {
+		delete(l.entries, key)
+		return nil
+	}
+	return e
+}
+
+func (l *MemoryLoginLimiter) LockedFor(ctx context.Context, key string) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e := l.entry(key, now)
+	if e == nil {
+		return 0, nil
+	}
+	return max(e.lockedUntil.Sub(now), 0), nil
+}
+
+func (l *MemoryLoginLimiter) RecordFailure(ctx context.Context, key string, policy LoginThrottlePolicy) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	e := l.entry(key, now)
+	if e == nil {
+		e = &memoryLoginEntry{}
+		l.entries[key] = e
+	}
+
+	e.failures++
+	lockout := policy.lockoutFor(e.failures)
+	if lockout > 0 {
+		e.lockedUntil = now.Add(lockout)
+	}
+	e.expiresAt = now.Add(max(policy.Window, lockout))
+
+	return lockout, nil
+}
+
+func (l *MemoryLoginLimiter) Reset(ctx context.Context, key string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	delete(l.entries, key)
+	return nil
+}
+
+var loginLimiter LoginLimiter
+
+func InitLoginLimiter() error {
+	// Use the in-memory backend when requested or when Redis is unavailable
+	if os.Getenv("LOGIN_LIMITER_BACKEND") == "memory" || GetRedisCloudClient() == nil {
+		loginLimiter = NewMemoryLoginLimiter()
+		return nil
+	}
+
+	loginLimiter = &RedisLoginLimiter{Client: GetRedisCloudClient()}
+	return nil
+}
+
+func GetLoginLimiter() LoginLimiter {
+	return loginLimiter
+}
+
+// RetryAfterSeconds formats a lockout for the Retry-After header, rounding up
+func RetryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,117 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Mail is a plain-text email message
+type Mail struct {
+	To      string
+	Subject string
+	Body    string
+}
+
+// Mailer delivers outgoing email
+type Mailer interface {
+	Send(ctx context.Context, mail Mail) error
+}
+
+// SMTPMailer sends email through an SMTP relay
+type SMTPMailer struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, mail Mail) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	// Build the message
+	var msg strings.Builder
+	fmt.Fprintf(&msg, "From: %s\r\n", m.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", mail.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mail.Subject)
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(mail.Body)
+
+	// Authenticate only when credentials are configured
+	var auth smtp.Auth
+	if m.Username != "" {
+		auth = smtp.PlainAuth("", m.Username, m.Password, m.Host)
+	}
+
+	return smtp.SendMail(net.JoinHostPort(m.Host, m.Port), auth, m.From, []string{mail.To}, []byte(msg.String()))
+}
+
+// LogMailer writes email to the log and keeps it in memory, for tests and local development
+type LogMailer struct {
+	mu   sync.Mutex
+	sent []Mail
+}
+
+func (m *LogMailer) Send(ctx context.Context, mail Mail) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, mail)
+	log.Printf("mail to=%s subject=%q\n%s", mail.To, mail.Subject, mail.Body)
+	return nil
+}
+
+// Sent returns a copy of every message sent so far
+func (m *LogMailer) Sent() []Mail {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]Mail(nil), m.sent...)
+}
+
+var mailer Mailer
+
+func InitMailer() error {
+	// Set SMTP configuration
+	host := os.Getenv("SMTP_HOST")
+	port := os.Getenv("SMTP_PORT")
+	username := os.Getenv("SMTP_USERNAME")
+	password := os.Getenv("SMTP_PASSWORD")
+	from := os.Getenv("SMTP_FROM")
+
+	// Fall back to the log mailer when SMTP is not configured
+	if host == "" {
+		mailer = &LogMailer{}
+		return nil
+	}
+
+	if from == "" {
+		return fmt.Errorf("missing SMTP_FROM in environment")
+	}
+	if port == "" {
+		port = "587"
+	}
+
+	mailer = &SMTPMailer{
+		Host:     host,
+		Port:     port,
+		Username: username,
+		Password: password,
+		From:     from,
+	}
+	return nil
+}
+
+func GetMailer() Mailer {
+	return mailer
+}
@@ -0,0 +1,214 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/redis/go-redis/v9"
+	"golang.org/x/oauth2"
+)
+
+const oidcStateTTL = 10 * time.Minute
+
+// ErrOIDCStateNotFound is returned for unknown, expired or already used login states
+var ErrOIDCStateNotFound = errors.New("login state not found")
+
+// OIDCProvider is a configured OpenID Connect identity provider
+type OIDCProvider struct {
+	Name     string
+	OAuth2   oauth2.Config
+	Verifier *oidc.IDTokenVerifier
+}
+
+// OIDCClaims are the ID token claims used to find or create a user
+type OIDCClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Name          string `json:"name"`
+	GivenName     string `json:"given_name"`
+	FamilyName    string `json:"family_name"`
+	Nonce         string `json:"nonce"`
+}
+
+// OIDCState is the server-side state kept between redirecting to the provider and its callback
+type OIDCState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"codeVerifier"`
+	RememberMe   bool   `json:"rememberMe"`
+	RedirectTo   string `json:"redirectTo"`
+}
+
+var oidcProviders = map[string]*OIDCProvider{}
+
+// InitOIDCProviders discovers every provider listed in OIDC_PROVIDERS. Each provider NAME is
+// configured with OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// optionally OIDC_<NAME>_SCOPES, so any compliant issuer, including a local mock, can be used.
+func InitOIDCProviders(ctx context.Context) error {
+	names := os.Getenv("OIDC_PROVIDERS")
+	if names == "" {
+		return nil
+	}
+
+	callbackBase := os.Getenv("OIDC_CALLBACK_BASE_URL")
+	if callbackBase == "" {
+		callbackBase = "http://localhost:8080/api/v1/users/oidc"
+	}
+
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		// Set provider configuration
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		issuer := os.Getenv(prefix + "ISSUER")
+		clientID := os.Getenv(prefix + "CLIENT_ID")
+		clientSecret := os.Getenv(prefix + "CLIENT_SECRET")
+		scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+		if v := os.Getenv(prefix + "SCOPES"); v != "" {
+			scopes = strings.Split(v, ",")
+		}
+
+		if issuer == "" || clientID == "" {
+			return fmt.Errorf("missing %sISSUER or %sCLIENT_ID in environment", prefix, prefix)
+		}
+
+		// Discover the provider endpoints
+		discoveryCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		provider, err := oidc.NewProvider(discoveryCtx, issuer)
+		cancel()
+		if err != nil {
+			return fmt.Errorf("failed to discover OIDC provider %s: %v", name, err)
+		}
+
+		oidcProviders[name] = &OIDCProvider{
+			Name: name,
+			OAuth2: oauth2.Config{
+				ClientID:     clientID,
+				ClientSecret: clientSecret,
+				Endpoint:     provider.Endpoint(),
+				RedirectURL:  callbackBase + "/" + name + "/callback",
+				Scopes:       scopes,
+			},
+			Verifier: provider.Verifier(&oidc.Config{ClientID: clientID}),
+		}
+	}
+
+	return nil
+}
+
+func GetOIDCProvider(name string) (*OIDCProvider, bool) {
+	provider, ok := oidcProviders[name]
+	return provider, ok
+}
+
+// AuthCodeURL builds the authorization URL with PKCE and nonce for a login state
+func (p *OIDCProvider) AuthCodeURL(state string, s OIDCState) string {
+	return p.OAuth2.AuthCodeURL(state, oidc.Nonce(s.Nonce), oauth2.S256ChallengeOption(s.CodeVerifier))
+}
+
+// Exchange redeems an authorization code and verifies the returned ID token and nonce
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, s OIDCState) (OIDCClaims, error) {
+	var claims OIDCClaims
+
+	token, err := p.OAuth2.Exchange(ctx, code, oauth2.VerifierOption(s.CodeVerifier))
+	if err != nil {
+		return claims, fmt.Errorf("code exchange failed: %w", err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return claims, errors.New("token response has no id_token")
+	}
+
+	idToken, err := p.Verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return claims, fmt.Errorf("invalid id_token: %w", err)
+	}
+
+	if err := idToken.Claims(&claims); err != nil {
+		return claims, fmt.Errorf("invalid id_token claims: %w", err)
+	}
+	if claims.Nonce != s.Nonce {
+		return claims, errors.New("id_token nonce mismatch")
+	}
+
+	return claims, nil
+}
+
+// NewOIDCState generates the nonce and PKCE verifier for a login
+func NewOIDCState(provider string, rememberMe bool, redirectTo string) (OIDCState, error) {
+	nonce, err := GenerateToken(32)
+	if err != nil {
+		return OIDCState{}, err
+	}
+
+	return OIDCState{
+		Provider:     provider,
+		Nonce:        nonce,
+		CodeVerifier: oauth2.GenerateVerifier(),
+		RememberMe:   rememberMe,
+		RedirectTo:   redirectTo,
+	}, nil
+}
+
+func oidcStateKey(state string) string {
+	return "oidc_state:" + state
+}
+
+// SaveOIDCState stores login state and returns the opaque state parameter to send to the provider
+func SaveOIDCState(ctx context.Context, s OIDCState) (string, error) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return "", errors.New("Redis client not initialized")
+	}
+
+	state, err := GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(s)
+	if err != nil {
+		return "", fmt.Errorf("could not serialize login state: %w", err)
+	}
+
+	if err := rdb.Set(ctx, oidcStateKey(state), payload, oidcStateTTL).Err(); err != nil {
+		return "", err
+	}
+
+	return state, nil
+}
+
+// TakeOIDCState loads and deletes login state, so each state parameter can be used only once
+func TakeOIDCState(ctx context.Context, state string) (OIDCState, error) {
+	var s OIDCState
+
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return s, errors.New("Redis client not initialized")
+	}
+
+	payload, err := rdb.GetDel(ctx, oidcStateKey(state)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return s, ErrOIDCStateNotFound
+	}
+	if err != nil {
+		return s, err
+	}
+
+	if err := json.Unmarshal(payload, &s); err != nil {
+		return s, fmt.Errorf("could not deserialize login state: %w", err)
+	}
+
+	return s, nil
+}
@@ -0,0 +1,156 @@
+package services
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const InvitationTTL = 7 * 24 * time.Hour
+
+var (
+	ErrMembershipNotFound = errors.New("membership not found")
+	ErrInvalidInvitation  = errors.New("invalid or expired invitation")
+	ErrInvitationEmail    = errors.New("invitation was sent to a different email address")
+)
+
+// VisibleTo scopes a query on chats or documents to the rows a user can see: their own
+// personal rows and every row owned by an organization they belong to
+func VisibleTo(userID uuid.UUID) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Where(
+			"((user_id = ? AND organization_id IS NULL) OR organization_id IN (SELECT organization_id FROM memberships WHERE user_id = ?))",
+			userID, userID,
+		)
+	}
+}
+
+// MembershipRoleAtLeast reports whether role is as privileged as min
+func MembershipRoleAtLeast(role string, min string) bool {
+	return slices.Index(models.MembershipRoles, role) >= slices.Index(models.MembershipRoles, min)
+}
+
+// FindMembership returns a user's membership in an organization
+func FindMembership(db *gorm.DB, organizationID uuid.UUID, userID uuid.UUID) (models.Membership, error) {
+	var membership models.Membership
+	err := db.
+		Joins("Organization").
+		Where("memberships.organization_id = ? AND memberships.user_id = ?", organizationID, userID).
+		First(&membership).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return membership, ErrMembershipNotFound
+	}
+	return membership, err
+}
+
+// CreateOrganization creates an organization owned by the user
+func CreateOrganization(db *gorm.DB, userID uuid.UUID, name string) (models.Organization, error) {
+	organization := models.Organization{Name: name}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&organization).Error; err != nil {
+			return err
+		}
+		return tx.Create(&models.Membership{
+			OrganizationID: organization.ID,
+			UserID:         userID,
+			Role:           models.MembershipRoleOwner,
+		}).Error
+	})
+	if err != nil {
+		return models.Organization{}, err
+	}
+
+	return organization, nil
+}
+
+// CountOwners returns how many owners an organization has
+func CountOwners(db *gorm.DB, organizationID uuid.UUID) (int64, error) {
+	var count int64
+	err := db.Model(&models.Membership{}).
+		Where("organization_id = ? AND role = ?", organizationID, models.MembershipRoleOwner).
+		Count(&count).Error
+	return count, err
+}
+
+// CreateInvitation stores an invitation and returns the raw token to mail to the invitee
+func CreateInvitation(db *gorm.DB, organizationID uuid.UUID, invitedByID uuid.UUID, email string, role string) (string, models.Invitation, error) {
+	token, err := GenerateToken(32)
+	if err != nil {
+		return "", models.Invitation{}, err
+	}
+
+	invitation := models.Invitation{
+		OrganizationID: organizationID,
+		InvitedByID:    invitedByID,
+		Email:          email,
+		Role:           role,
+		TokenHash:      HashToken(token),
+		ExpiresAt:      time.Now().Add(InvitationTTL),
+	}
+	if err := db.Create(&invitation).Error; err != nil {
+		return "", models.Invitation{}, err
+	}
+
+	return token, invitation, nil
+}
+
+// AcceptInvitation adds the user to the invited organization. The user's verified email
+// must match the address the invitation was sent to.
+func AcceptInvitation(db *gorm.DB, token string, user models.User) (models.Membership, error) {
+	var membership models.Membership
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		var invitation models.Invitation
+		err := tx.
+			Where("token_hash = ? AND accepted_at IS NULL AND expires_at > ?", HashToken(token), time.Now()).
+			First(&invitation).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidInvitation
+		}
+		if err != nil {
+			return err
+		}
+
+		if !user.IsEmailVerified || !strings.EqualFold(user.Email, invitation.Email) {
+			return ErrInvitationEmail
+		}
+
+		// Mark the invitation used so it cannot be replayed
+		result := tx.Model(&invitation).Where("accepted_at IS NULL").Update("accepted_at", time.Now())
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidInvitation
+		}
+
+		// Existing members keep their current role
+		existing, err := FindMembership(tx, invitation.OrganizationID, user.ID)
+		if err == nil {
+			membership = existing
+			return nil
+		}
+		if !errors.Is(err, ErrMembershipNotFound) {
+			return err
+		}
+
+		membership = models.Membership{
+			OrganizationID: invitation.OrganizationID,
+			UserID:         user.ID,
+			Role:           invitation.Role,
+		}
+		return tx.Create(&membership).Error
+	})
+	if err != nil {
+		return models.Membership{}, err
+	}
+
+	return membership, nil
+}
@@ -0,0 +1,282 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+var ErrUnknownPasswordHash = errors.New("unknown password hash format")
+
+// PasswordHasher hashes passwords with one algorithm and verifies hashes it produced
+type PasswordHasher interface {
+	// Hash returns the encoded hash of a password
+	Hash(password string) (string, error)
+	// Verify reports whether the password matches an encoded hash
+	Verify(encoded string, password string) (bool, error)
+	// Identifies reports whether an encoded hash was produced by this algorithm
+	Identifies(encoded string) bool
+	// NeedsRehash reports whether an encoded hash uses weaker parameters than the hasher's
+	NeedsRehash(encoded string) bool
+}
+
+// Argon2idHasher encodes hashes as PHC strings, for example
+// $argon2id$v=19$m=19456,t=2,p=1$<salt>$<hash>
+type Argon2idHasher struct {
+	Memory      uint32 // KiB
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+const argon2idPrefix = "$argon2id$"
+
+type argon2idHash struct {
+	version     int
+	memory      uint32
+	iterations  uint32
+	parallelism uint8
+	salt        []byte
+	key         []byte
+}
+
+func parseArgon2idHash(encoded string) (argon2idHash, error) {
+	var h argon2idHash
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 || parts[1] != "argon2id" {
+		return h, ErrUnknownPasswordHash
+	}
+
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &h.version); err != nil {
+		return h, err
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &h.memory, &h.iterations, &h.parallelism); err != nil {
+		return h, err
+	}
+
+	var err error
+	if h.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil {
+		return h, err
+	}
+	if h.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil {
+		return h, err
+	}
+
+	return h, nil
+}
+
+func (a Argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix, argon2.Version, a.Memory, a.Iterations, a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (a Argon2idHasher) Verify(encoded string, password string) (bool, error) {
+	h, err := parseArgon2idHash(encoded)
+	if err != nil {
+		return false, err
+	}
+	if h.version != argon2.Version {
+		return false, fmt.Errorf("unsupported argon2 version %d", h.version)
+	}
+
+	key := argon2.IDKey([]byte(password), h.salt, h.iterations, h.memory, h.parallelism, uint32(len(h.key)))
+
+	return subtle.ConstantTimeCompare(key, h.key) == 1, nil
+}
+
+func (a Argon2idHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, argon2idPrefix)
+}
+
+func (a Argon2idHasher) NeedsRehash(encoded string) bool {
+	h, err := parseArgon2idHash(encoded)
+	if err != nil {
+		return true
+	}
+	return h.version != argon2.Version ||
+		h.memory < a.Memory ||
+		h.iterations < a.Iterations ||
+		h.parallelism != a.Parallelism ||
+		uint32(len(h.salt)) < a.SaltLength ||
+		uint32(len(h.key)) < a.KeyLength
+}
+
+// BcryptHasher produces modular crypt bcrypt hashes
+type BcryptHasher struct {
+	Cost int
+}
+
+func (b BcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), b.Cost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+func (b BcryptHasher) Verify(encoded string, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+	if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (b BcryptHasher) Identifies(encoded string) bool {
+	return strings.HasPrefix(encoded, "$2a$") || strings.HasPrefix(encoded, "$2b$") || strings.HasPrefix(encoded, "$2y$")
+}
+
+func (b BcryptHasher) NeedsRehash(encoded string) bool {
+	cost, err := bcrypt.Cost([]byte(encoded))
+	return err != nil || cost < b.Cost
+}
+
+// DefaultArgon2idHasher follows the OWASP baseline for argon2id
+var DefaultArgon2idHasher = Argon2idHasher{
+	Memory:      19 * 1024,
+	Iterations:  2,
+	Parallelism: 1,
+	SaltLength:  16,
+	KeyLength:   32,
+}
+
+var (
+	// passwordHasher hashes new passwords; hashes from any of passwordHashers still verify
+	passwordHasher  PasswordHasher = DefaultArgon2idHasher
+	passwordHashers                = []PasswordHasher{DefaultArgon2idHasher, BcryptHasher{Cost: bcrypt.DefaultCost}}
+)
+
+func envUint(name string, fallback uint64, bits int) (uint64, error) {
+	v := os.Getenv(name)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.ParseUint(v, 10, bits)
+	if err != nil || n == 0 {
+		return 0, fmt.Errorf("invalid %s: %q", name, v)
+	}
+	return n, nil
+}
+
+// InitPasswordHasher configures how new passwords are hashed. PASSWORD_HASH_ALGORITHM selects
+// argon2id (the default) or bcrypt; ARGON2ID_MEMORY_KIB, ARGON2ID_ITERATIONS,
+// ARGON2ID_PARALLELISM and BCRYPT_COST tune them. Stored hashes of either algorithm keep
+// verifying and are upgraded on sign-in when they fall behind the configuration.
+func InitPasswordHasher() error {
+	memory, err := envUint("ARGON2ID_MEMORY_KIB", uint64(DefaultArgon2idHasher.Memory), 32)
+	if err != nil {
+		return err
+	}
+	iterations, err := envUint("ARGON2ID_ITERATIONS", uint64(DefaultArgon2idHasher.Iterations), 32)
+	if err != nil {
+		return err
+	}
+	parallelism, err := envUint("ARGON2ID_PARALLELISM", uint64(DefaultArgon2idHasher.Parallelism), 8)
+	if err != nil {
+		return err
+	}
+	cost, err := envUint("BCRYPT_COST", uint64(bcrypt.DefaultCost), 8)
+	if err != nil {
+		return err
+	}
+	if int(cost) < bcrypt.MinCost || int(cost) > bcrypt.MaxCost {
+		return fmt.Errorf("invalid BCRYPT_COST: %d", cost)
+	}
+
+	argon2idHasher := DefaultArgon2idHasher
+	argon2idHasher.Memory = uint32(memory)
+	argon2idHasher.Iterations = uint32(iterations)
+	argon2idHasher.Parallelism = uint8(parallelism)
+
+	bcryptHasher := BcryptHasher{Cost: int(cost)}
+
+	passwordHashers = []PasswordHasher{argon2idHasher, bcryptHasher}
+
+	switch algorithm := os.Getenv("PASSWORD_HASH_ALGORITHM"); algorithm {
+	case "", "argon2id":
+		passwordHasher = argon2idHasher
+	case "bcrypt":
+		passwordHasher = bcryptHasher
+	default:
+		return fmt.Errorf("unknown PASSWORD_HASH_ALGORITHM: %q", algorithm)
+	}
+
+	return nil
+}
+
+// HashPassword hashes a password with the configured algorithm
+func HashPassword(password string) (string, error) {
+	return passwordHasher.Hash(password)
+}
+
+// VerifyPassword reports whether the password matches a stored hash of any supported algorithm.
+// Accounts without a password never match.
+func VerifyPassword(encoded string, password string) (bool, error) {
+	if encoded == "" {
+		return false, nil
+	}
+	for _, hasher := range passwordHashers {
+		if hasher.Identifies(encoded) {
+			return hasher.Verify(encoded, password)
+		}
+	}
+	return false, ErrUnknownPasswordHash
+}
+
+// PasswordNeedsRehash reports whether a stored hash uses another algorithm or weaker
+// parameters than the configured hasher
+func PasswordNeedsRehash(encoded string) bool {
+	return !passwordHasher.Identifies(encoded) || passwordHasher.NeedsRehash(encoded)
+}
+
+// UpgradePasswordHash rehashes a just-verified password when its stored hash is outdated.
+// The update only applies if the stored hash is unchanged, so it never overwrites a
+// password that was changed concurrently.
+func UpgradePasswordHash(db *gorm.DB, user models.User, password string) {
+	if user.Password == "" || !PasswordNeedsRehash(user.Password) {
+		return
+	}
+
+	hash, err := HashPassword(password)
+	if err != nil {
+		log.Printf("error rehashing password for user %s: %v", user.ID, err)
+		return
+	}
+
+	result := db.Model(&models.User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hash)
+	if result.Error != nil {
+		log.Printf("error upgrading password hash for user %s: %v", user.ID, result.Error)
+		return
+	}
+	if result.RowsAffected == 1 {
+		InvalidateUserSessionCache(context.Background(), user.ID)
+	}
+}
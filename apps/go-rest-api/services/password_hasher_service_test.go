@@ -0,0 +1,181 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// fastArgon2idHasher keeps the tests quick; the parameters only need to round-trip
+var fastArgon2idHasher = Argon2idHasher{Memory: 64, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}
+
+func TestPasswordHasherRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		hasher PasswordHasher
+		other  PasswordHasher
+	}{
+		{name: "argon2id", hasher: fastArgon2idHasher, other: BcryptHasher{Cost: bcrypt.MinCost}},
+		{name: "bcrypt", hasher: BcryptHasher{Cost: bcrypt.MinCost}, other: fastArgon2idHasher},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hasher.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !tt.hasher.Identifies(encoded) {
+				t.Errorf("%s does not identify its own hash %q", tt.name, encoded)
+			}
+			if tt.other.Identifies(encoded) {
+				t.Errorf("another hasher identifies %q", encoded)
+			}
+
+			if ok, err := tt.hasher.Verify(encoded, "correct horse battery staple"); err != nil || !ok {
+				t.Errorf("Verify(correct) = %v, %v; want true, nil", ok, err)
+			}
+			if ok, err := tt.hasher.Verify(encoded, "Correct horse battery staple"); err != nil || ok {
+				t.Errorf("Verify(wrong) = %v, %v; want false, nil", ok, err)
+			}
+
+			// Salting makes every hash of the same password different
+			again, err := tt.hasher.Hash("correct horse battery staple")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if again == encoded {
+				t.Error("hashing twice gave the same hash")
+			}
+		})
+	}
+}
+
+func TestArgon2idHasherRejectsMalformedHashes(t *testing.T) {
+	tests := []struct {
+		name    string
+		encoded string
+	}{
+		{name: "too few fields", encoded: "$argon2id$v=19$m=64,t=1,p=1$c2FsdA"},
+		{name: "other algorithm", encoded: "$argon2i$v=19$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5"},
+		{name: "bad parameters", encoded: "$argon2id$v=19$m=x,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5"},
+		{name: "bad salt", encoded: "$argon2id$v=19$m=64,t=1,p=1$!!!$a2V5"},
+		{name: "unsupported version", encoded: "$argon2id$v=16$m=64,t=1,p=1$c2FsdHNhbHRzYWx0$a2V5"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if ok, err := fastArgon2idHasher.Verify(tt.encoded, "password"); err == nil || ok {
+				t.Errorf("Verify(%q) = %v, %v; want false and an error", tt.encoded, ok, err)
+			}
+			if !fastArgon2idHasher.NeedsRehash(tt.encoded) {
+				t.Errorf("NeedsRehash(%q) = false, want true", tt.encoded)
+			}
+		})
+	}
+}
+
+func TestPasswordHasherNeedsRehash(t *testing.T) {
+	weakArgon2id := fastArgon2idHasher
+	strongArgon2id := fastArgon2idHasher
+	strongArgon2id.Memory *= 2
+	moreParallel := fastArgon2idHasher
+	moreParallel.Parallelism = 2
+
+	tests := []struct {
+		name   string
+		hashed PasswordHasher
+		hasher PasswordHasher
+		want   bool
+	}{
+		{name: "argon2id same parameters", hashed: weakArgon2id, hasher: weakArgon2id, want: false},
+		{name: "argon2id stronger parameters", hashed: strongArgon2id, hasher: weakArgon2id, want: false},
+		{name: "argon2id less memory", hashed: weakArgon2id, hasher: strongArgon2id, want: true},
+		{name: "argon2id other parallelism", hashed: weakArgon2id, hasher: moreParallel, want: true},
+		{name: "bcrypt same cost", hashed: BcryptHasher{Cost: bcrypt.MinCost}, hasher: BcryptHasher{Cost: bcrypt.MinCost}, want: false},
+		{name: "bcrypt lower cost", hashed: BcryptHasher{Cost: bcrypt.MinCost}, hasher: BcryptHasher{Cost: bcrypt.MinCost + 1}, want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := tt.hashed.Hash("password")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := tt.hasher.NeedsRehash(encoded); got != tt.want {
+				t.Errorf("NeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	argon2idHash, err := fastArgon2idHasher.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bcryptHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		encoded  string
+		password string
+		want     bool
+		wantErr  error
+	}{
+		{name: "argon2id match", encoded: argon2idHash, password: "hunter2", want: true},
+		{name: "argon2id mismatch", encoded: argon2idHash, password: "hunter3"},
+		{name: "bcrypt match", encoded: bcryptHash, password: "hunter2", want: true},
+		{name: "bcrypt mismatch", encoded: bcryptHash, password: "hunter3"},
+		{name: "no password", encoded: "", password: ""},
+		{name: "no password with input", encoded: "", password: "hunter2"},
+		{name: "plaintext", encoded: "hunter2", password: "hunter2", wantErr: ErrUnknownPasswordHash},
+		{name: "unknown scheme", encoded: "$1$salt$digest", password: "hunter2", wantErr: ErrUnknownPasswordHash},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := VerifyPassword(tt.encoded, tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("VerifyPassword() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordNeedsRehash(t *testing.T) {
+	bcryptHash, err := BcryptHasher{Cost: bcrypt.MinCost}.Hash("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, err := HashPassword("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		encoded string
+		want    bool
+	}{
+		{name: "configured algorithm", encoded: current, want: false},
+		{name: "other algorithm", encoded: bcryptHash, want: true},
+		{name: "unknown", encoded: "hunter2", want: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := PasswordNeedsRehash(tt.encoded); got != tt.want {
+				t.Errorf("PasswordNeedsRehash() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	phoneOTPTTL         = 10 * time.Minute
+	phoneOTPCooldown    = time.Minute
+	phoneOTPMaxAttempts = 5
+	phoneOTPSendWindow  = 24 * time.Hour
+	phoneOTPMaxSends    = 5
+)
+
+var (
+	ErrPhoneOTPInvalid         = errors.New("invalid code")
+	ErrPhoneOTPNotFound        = errors.New("no pending verification")
+	ErrPhoneOTPTooManyAttempts = errors.New("too many attempts")
+)
+
+// RateLimitError is returned when an action is throttled, with the time until it is allowed again
+type RateLimitError struct {
+	RetryAfter time.Duration
+}
+
+func (e *RateLimitError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s", e.RetryAfter)
+}
+
+func phoneOTPKey(userID uuid.UUID) string {
+	return "phone_otp:" + userID.String()
+}
+
+func phoneOTPCooldownKey(userID uuid.UUID) string {
+	return "phone_otp_cooldown:" + userID.String()
+}
+
+func phoneOTPSendsKey(phone string) string {
+	return "phone_otp_sends:" + phone
+}
+
+func hashPhoneOTP(userID uuid.UUID, phone string, code string) string {
+	return HashToken(userID.String() + ":" + phone + ":" + code)
+}
+
+// StartPhoneVerification stores a hashed one-time code for the user's phone and returns the code to send
+func StartPhoneVerification(ctx context.Context, userID uuid.UUID, phone string) (string, error) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return "", errors.New("Redis client not initialized")
+	}
+
+	// Enforce the cooldown between sends for this user
+	ok, err := rdb.SetNX(ctx, phoneOTPCooldownKey(userID), 1, phoneOTPCooldown).Result()
+	if err != nil {
+		return "", err
+	}
+	if !ok {
+		ttl, err := rdb.TTL(ctx, phoneOTPCooldownKey(userID)).Result()
+		if err != nil || ttl < 0 {
+			ttl = phoneOTPCooldown
+		}
+		return "", &RateLimitError{RetryAfter: ttl}
+	}
+
+	// Cap the number of codes sent to a single number
+	sends, err := rdb.Incr(ctx, phoneOTPSendsKey(phone)).Result()
+	if err != nil {
+		return "", err
+	}
+	if sends == 1 {
+		rdb.Expire(ctx, phoneOTPSendsKey(phone), phoneOTPSendWindow)
+	}
+	if sends > phoneOTPMaxSends {
+		ttl, err := rdb.TTL(ctx, phoneOTPSendsKey(phone)).Result()
+		if err != nil || ttl < 0 {
+			ttl = phoneOTPSendWindow
+		}
+		return "", &RateLimitError{RetryAfter: ttl}
+	}
+
+	// Generate a six digit code
+	n, err := rand.Int(rand.Reader, big.NewInt(1_000_000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+
+	// Store the hashed code, replacing any pending one
+	key := phoneOTPKey(userID)
+	_, err = rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(ctx, key)
+		pipe.HSet(ctx, key, "code_hash", hashPhoneOTP(userID, phone, code), "phone", phone, "attempts", 0)
+		pipe.Expire(ctx, key, phoneOTPTTL)
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// ConfirmPhoneVerification checks a code against the pending verification for the user's phone
+func ConfirmPhoneVerification(ctx context.Context, userID uuid.UUID, phone string, code string) error {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return errors.New("Redis client not initialized")
+	}
+
+	// Load the pending verification
+	key := phoneOTPKey(userID)
+	pending, err := rdb.HGetAll(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if len(pending) == 0 || pending["phone"] != phone {
+		return ErrPhoneOTPNotFound
+	}
+
+	// Count the attempt before checking the code
+	attempts, err := rdb.HIncrBy(ctx, key, "attempts", 1).Result()
+	if err != nil {
+		return err
+	}
+	if attempts > phoneOTPMaxAttempts {
+		rdb.Del(ctx, key)
+		return ErrPhoneOTPTooManyAttempts
+	}
+
+	// Compare the code
+	expected := pending["code_hash"]
+	actual := hashPhoneOTP(userID, phone, code)
+	if subtle.ConstantTimeCompare([]byte(expected), []byte(actual)) != 1 {
+		return ErrPhoneOTPInvalid
+	}
+
+	// Codes are single use
+	return rdb.Del(ctx, key).Err()
+}
@@ -0,0 +1,174 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	RefreshTokenPrefix = "brb_rt_"
+	RefreshTokenTTL    = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	// ErrRefreshTokenReused means a rotated refresh token came back, so it has leaked;
+	// the whole session is revoked
+	ErrRefreshTokenReused = errors.New("refresh token reused")
+)
+
+func newRefreshToken() (string, string, error) {
+	secret, err := GenerateToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	token := RefreshTokenPrefix + secret
+	return token, HashToken(token), nil
+}
+
+// CreateRefreshSession starts a token-endpoint session and returns its first refresh token.
+// Like CreateSession it counts as signing in and cancels a pending account deletion.
+func CreateRefreshSession(db *gorm.DB, userID uuid.UUID, ipAddress string, userAgent string) (string, models.Session, error) {
+	if err := CancelAccountDeletion(db, userID); err != nil {
+		return "", models.Session{}, err
+	}
+
+	refreshToken, digest, err := newRefreshToken()
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	var session models.Session
+	err = db.Transaction(func(tx *gorm.DB) error {
+		var err error
+		now := time.Now()
+		_, session, err = createSession(tx, models.Session{
+			UserID:          userID,
+			ExpiresAt:       now.Add(RefreshTokenTTL),
+			IPAddress:       &ipAddress,
+			UserAgent:       &userAgent,
+			AuthenticatedAt: &now,
+		})
+		if err != nil {
+			return err
+		}
+
+		return tx.Create(&models.RefreshToken{SessionID: session.ID, TokenHash: digest}).Error
+	})
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	return refreshToken, session, nil
+}
+
+// RotateRefreshToken exchanges a refresh token for a new one and extends the session. Any
+// token the session already rotated away from revokes the session, since it must have leaked,
+// and returns ErrRefreshTokenReused along with the revoked session.
+func RotateRefreshToken(db *gorm.DB, token string) (string, models.Session, error) {
+	digest := HashToken(token)
+
+	refreshToken, nextDigest, err := newRefreshToken()
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	var session models.Session
+	reused := false
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Find the token, holding it so concurrent rotations are serialised
+		var record models.RefreshToken
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("token_hash = ?", digest).
+			First(&record).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := tx.First(&session, "id = ?", record.SessionID).Error; err != nil {
+			return err
+		}
+
+		// Revoke the whole session on reuse of any rotated token; the revocation has to commit,
+		// so the error is returned once the transaction is done
+		if record.RotatedAt != nil {
+			reused = true
+			return tx.Delete(&session).Error
+		}
+
+		if !session.ExpiresAt.After(time.Now()) {
+			return ErrInvalidRefreshToken
+		}
+
+		// Retire the token and issue its successor
+		now := time.Now()
+		if err := tx.Model(&record).Update("rotated_at", now).Error; err != nil {
+			return err
+		}
+		if err := tx.Create(&models.RefreshToken{SessionID: session.ID, TokenHash: nextDigest}).Error; err != nil {
+			return err
+		}
+
+		session.ExpiresAt = now.Add(RefreshTokenTTL)
+		return tx.Model(&session).Update("expires_at", session.ExpiresAt).Error
+	})
+	if err != nil {
+		return "", models.Session{}, err
+	}
+	if reused {
+		InvalidateUserSessionCache(context.Background(), session.UserID)
+		return "", session, ErrRefreshTokenReused
+	}
+
+	return refreshToken, session, nil
+}
+
+// RevokeRefreshToken ends the session a current refresh token belongs to
+func RevokeRefreshToken(db *gorm.DB, token string) error {
+	var record models.RefreshToken
+	err := db.Where("token_hash = ? AND rotated_at IS NULL", HashToken(token)).First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return err
+	}
+
+	var session models.Session
+	if err := db.First(&session, "id = ?", record.SessionID).Error; err != nil {
+		return err
+	}
+
+	return RevokeSession(db, session)
+}
+
+// FindAccessTokenSession loads the session an access token was issued for, with its user
+// and roles. Reading the session keeps its flags, such as ReadOnly, in force on the bearer
+// path and ends access as soon as the session is revoked rather than when the token expires.
+func FindAccessTokenSession(db *gorm.DB, claims AccessClaims) (models.Session, error) {
+	var session models.Session
+
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return session, ErrInvalidAccessToken
+	}
+
+	err = db.
+		Preload("User.Roles").
+		Where("id = ? AND user_id = ? AND expires_at > ?", claims.SessionID, userID, time.Now()).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, ErrInvalidAccessToken
+	}
+	return session, err
+}
@@ -0,0 +1,99 @@
+package services
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/spanhornet/brambles/apps/go-rest-api/internal/testdb"
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func TestRotateRefreshToken(t *testing.T) {
+	db := testdb.Open(t)
+
+	const rotations = 3
+
+	tests := []struct {
+		name string
+		// presented picks the token to present from the chain, oldest first
+		presented   func(chain []string) string
+		wantErr     error
+		wantRevoked bool
+	}{
+		{name: "current token rotates", presented: func(chain []string) string { return chain[len(chain)-1] }},
+		{name: "previous token is reuse", presented: func(chain []string) string { return chain[len(chain)-2] }, wantErr: ErrRefreshTokenReused, wantRevoked: true},
+		{name: "older token is reuse", presented: func(chain []string) string { return chain[0] }, wantErr: ErrRefreshTokenReused, wantRevoked: true},
+		{name: "unknown token is invalid", presented: func([]string) string { return RefreshTokenPrefix + "unknown" }, wantErr: ErrInvalidRefreshToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			user := testdb.CreateUser(t, db, models.User{})
+
+			token, session, err := CreateRefreshSession(db, user.ID, "127.0.0.1", "test")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			chain := []string{token}
+			for range rotations {
+				next, rotated, err := RotateRefreshToken(db, chain[len(chain)-1])
+				if err != nil {
+					t.Fatalf("rotating: %v", err)
+				}
+				if rotated.ID != session.ID {
+					t.Fatalf("rotation moved to session %s, want %s", rotated.ID, session.ID)
+				}
+				chain = append(chain, next)
+			}
+
+			_, got, err := RotateRefreshToken(db, tt.presented(chain))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr == ErrRefreshTokenReused && got.ID != session.ID {
+				t.Errorf("reuse reported session %s, want %s", got.ID, session.ID)
+			}
+
+			var sessions int64
+			if err := db.Model(&models.Session{}).Where("id = ?", session.ID).Count(&sessions).Error; err != nil {
+				t.Fatal(err)
+			}
+			if revoked := sessions == 0; revoked != tt.wantRevoked {
+				t.Fatalf("session revoked = %v, want %v", revoked, tt.wantRevoked)
+			}
+
+			// The live token stops working once the session is revoked
+			if tt.wantRevoked {
+				if _, _, err := RotateRefreshToken(db, chain[len(chain)-1]); !errors.Is(err, ErrInvalidRefreshToken) {
+					t.Errorf("current token after reuse: err = %v, want %v", err, ErrInvalidRefreshToken)
+				}
+			}
+		})
+	}
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	db := testdb.Open(t)
+	user := testdb.CreateUser(t, db, models.User{})
+
+	token, _, err := CreateRefreshSession(db, user.ID, "127.0.0.1", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, _, err := RotateRefreshToken(db, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the current token can revoke the session
+	if err := RevokeRefreshToken(db, token); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("revoking a rotated token: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+	if err := RevokeRefreshToken(db, next); err != nil {
+		t.Fatalf("revoking the current token: %v", err)
+	}
+	if _, _, err := RotateRefreshToken(db, next); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("rotating a revoked token: err = %v, want %v", err, ErrInvalidRefreshToken)
+	}
+}
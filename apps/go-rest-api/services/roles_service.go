@@ -0,0 +1,118 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+var ErrRoleNotFound = errors.New("role not found")
+
+// HasPermission reports whether any of the user's roles grants the permission. The user's
+// roles must be loaded, which FindSession does.
+func HasPermission(user models.User, permission string) bool {
+	for _, role := range user.Roles {
+		if slices.Contains(role.Permissions, permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// UserPermissions returns the sorted, deduplicated permissions granted by the user's roles
+func UserPermissions(user models.User) []string {
+	permissions := []string{}
+	for _, role := range user.Roles {
+		permissions = append(permissions, role.Permissions...)
+	}
+	slices.Sort(permissions)
+	return slices.Compact(permissions)
+}
+
+// SeedRoles creates the admin role, keeps its permissions current, and grants it to the
+// verified users listed in ADMIN_EMAILS so existing admins keep their access
+func SeedRoles(db *gorm.DB) error {
+	admin := models.Role{
+		Name:        models.RoleAdmin,
+		Description: "Full access to internal administration endpoints",
+		Permissions: models.Permissions,
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "name"}},
+		DoUpdates: clause.AssignmentColumns([]string{"permissions", "updated_at"}),
+	}).Create(&admin).Error
+	if err != nil {
+		return err
+	}
+	if err := db.First(&admin, "name = ?", models.RoleAdmin).Error; err != nil {
+		return err
+	}
+
+	for _, email := range strings.Split(os.Getenv("ADMIN_EMAILS"), ",") {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" {
+			continue
+		}
+
+		var user models.User
+		err := db.Where("LOWER(email) = ? AND is_email_verified = ?", email, true).First(&user).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if err := db.Model(&user).Association("Roles").Append(&admin); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// AssignRole grants a role to a user by name
+func AssignRole(db *gorm.DB, userID uuid.UUID, name string) error {
+	var role models.Role
+	err := db.First(&role, "name = ?", name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := db.Model(&models.User{ID: userID}).Association("Roles").Append(&role); err != nil {
+		return err
+	}
+
+	InvalidateUserSessionCache(context.Background(), userID)
+	return nil
+}
+
+// RemoveRole takes a role away from a user by name
+func RemoveRole(db *gorm.DB, userID uuid.UUID, name string) error {
+	var role models.Role
+	err := db.First(&role, "name = ?", name).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrRoleNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := db.Model(&models.User{ID: userID}).Association("Roles").Delete(&role); err != nil {
+		return err
+	}
+
+	InvalidateUserSessionCache(context.Background(), userID)
+	return nil
+}
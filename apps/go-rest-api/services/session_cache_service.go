@@ -0,0 +1,339 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	// sessionCacheTTL bounds how long a cached snapshot can outlive a change that forgot to invalidate it
+	sessionCacheTTL = 5 * time.Minute
+
+	// sessionCacheGenerationTTL keeps a user's generation long enough to outlast any lookup in flight
+	sessionCacheGenerationTTL = time.Hour
+)
+
+// cacheSessionScript writes a snapshot only while the user's generation still matches the one
+// read before the session was loaded, so a lookup that raced an invalidation cannot put the
+// stale snapshot back
+var cacheSessionScript = redis.NewScript(`
+if tonumber(redis.call("GET", KEYS[3]) or "0") ~= tonumber(ARGV[1]) then
+	return 0
+end
+redis.call("SET", KEYS[1], ARGV[2], "PX", ARGV[3])
+redis.call("SADD", KEYS[2], ARGV[4])
+redis.call("PEXPIRE", KEYS[2], ARGV[5])
+return 1
+`)
+
+func sessionCacheKey(digest string) string {
+	return "session:" + digest
+}
+
+func userSessionCacheKey(userID uuid.UUID) string {
+	return "user_sessions:" + userID.String()
+}
+
+func userSessionCacheGenerationKey(userID uuid.UUID) string {
+	return "user_sessions_gen:" + userID.String()
+}
+
+func accessSessionCacheKey(sessionID uuid.UUID) string {
+	return "access_session:" + sessionID.String()
+}
+
+// accessSessionSnapshot is a cached access token session, stamped with the user's cache
+// generation when it was loaded
+type accessSessionSnapshot struct {
+	Generation int64
+	Session    models.Session
+}
+
+// LookupSession resolves a raw session token through the Redis cache, falling back to
+// FindSession and caching the result. The snapshot includes the user and their roles, but
+// never the user's credentials; see WithoutCredentials.
+func LookupSession(ctx context.Context, db *gorm.DB, token string) (models.Session, error) {
+	if token == "" {
+		return models.Session{}, ErrSessionNotFound
+	}
+
+	digest := HashSessionToken(token)
+	if session, ok := cachedSession(ctx, digest); ok {
+		return session, nil
+	}
+
+	// Read the owner's generation before loading the session, so a change committed in
+	// between keeps the snapshot out of the cache. Legacy tokens are not found by digest
+	// and are cached on their next lookup, once FindSession has converted them.
+	var owners []uuid.UUID
+	if err := db.Model(&models.Session{}).Where("token_hash = ?", digest).Limit(1).Pluck("user_id", &owners).Error; err != nil {
+		return models.Session{}, err
+	}
+
+	var generation int64
+	cacheable := false
+	if len(owners) > 0 {
+		generation, cacheable = sessionCacheGeneration(ctx, owners[0])
+	}
+
+	session, err := FindSession(db, token)
+	if err != nil {
+		return session, err
+	}
+	session.User = WithoutCredentials(session.User)
+
+	if cacheable && session.UserID == owners[0] {
+		cacheSession(ctx, session, generation)
+	}
+	return session, nil
+}
+
+// LookupAccessTokenSession resolves the session an access token was issued for through the
+// Redis cache, falling back to FindAccessTokenSession. Snapshots are keyed by session ID and
+// only trusted while the user's cache generation is unchanged, so revoking the session or
+// changing the user ends bearer access as promptly as it ends cookie access.
+func LookupAccessTokenSession(ctx context.Context, db *gorm.DB, claims AccessClaims) (models.Session, error) {
+	userID, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return models.Session{}, ErrInvalidAccessToken
+	}
+
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		session, err := FindAccessTokenSession(db, claims)
+		session.User = WithoutCredentials(session.User)
+		return session, err
+	}
+
+	// Read the generation and the snapshot together; the generation is read before the
+	// session is loaded, so a change committed in between leaves a snapshot that never matches
+	key := accessSessionCacheKey(claims.SessionID)
+	values, err := rdb.MGet(ctx, userSessionCacheGenerationKey(userID), key).Result()
+	cacheable := err == nil
+	if err != nil {
+		log.Printf("error reading session cache: %v", err)
+	}
+
+	var generation int64
+	if cacheable {
+		if raw, ok := values[0].(string); ok {
+			if generation, err = strconv.ParseInt(raw, 10, 64); err != nil {
+				cacheable = false
+			}
+		}
+	}
+
+	if cacheable {
+		if raw, ok := values[1].(string); ok {
+			var snapshot accessSessionSnapshot
+			err := gob.NewDecoder(strings.NewReader(raw)).Decode(&snapshot)
+			if err == nil &&
+				snapshot.Generation == generation &&
+				snapshot.Session.UserID == userID &&
+				snapshot.Session.ExpiresAt.After(time.Now()) {
+				return snapshot.Session, nil
+			}
+		}
+	}
+
+	session, err := FindAccessTokenSession(db, claims)
+	if err != nil {
+		return session, err
+	}
+	session.User = WithoutCredentials(session.User)
+
+	if cacheable {
+		ttl := min(sessionCacheTTL, time.Until(session.ExpiresAt))
+
+		var buf bytes.Buffer
+		if err := gob.NewEncoder(&buf).Encode(accessSessionSnapshot{Generation: generation, Session: session}); err != nil {
+			log.Printf("error encoding session cache: %v", err)
+		} else if ttl > 0 {
+			if err := rdb.Set(ctx, key, buf.Bytes(), ttl).Err(); err != nil {
+				log.Printf("error writing session cache: %v", err)
+			}
+		}
+	}
+	return session, nil
+}
+
+// sessionCacheGeneration returns the user's current cache generation, and false when it cannot be read
+func sessionCacheGeneration(ctx context.Context, userID uuid.UUID) (int64, bool) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return 0, false
+	}
+
+	generation, err := rdb.Get(ctx, userSessionCacheGenerationKey(userID)).Int64()
+	if errors.Is(err, redis.Nil) {
+		return 0, true
+	}
+	if err != nil {
+		log.Printf("error reading session cache: %v", err)
+		return 0, false
+	}
+
+	return generation, true
+}
+
+// cachedSession returns the cached snapshot for a digest, if present and unexpired
+func cachedSession(ctx context.Context, digest string) (models.Session, bool) {
+	var session models.Session
+
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return session, false
+	}
+
+	data, err := rdb.Get(ctx, sessionCacheKey(digest)).Bytes()
+	if err != nil {
+		if !errors.Is(err, redis.Nil) {
+			log.Printf("error reading session cache: %v", err)
+		}
+		return session, false
+	}
+
+	// gob keeps the fields the JSON encoding hides, like the user's TOTP state
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&session); err != nil {
+		return session, false
+	}
+	if !session.ExpiresAt.After(time.Now()) {
+		return session, false
+	}
+
+	return session, true
+}
+
+// cacheSession stores a snapshot of the session until it expires or sessionCacheTTL passes,
+// unless the user's cache generation has moved on from the one given
+func cacheSession(ctx context.Context, session models.Session, generation int64) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil || session.TokenHash == "" {
+		return
+	}
+
+	ttl := min(sessionCacheTTL, time.Until(session.ExpiresAt))
+	if ttl <= 0 {
+		return
+	}
+
+	session.User = WithoutCredentials(session.User)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(session); err != nil {
+		log.Printf("error encoding session cache: %v", err)
+		return
+	}
+
+	keys := []string{
+		sessionCacheKey(session.TokenHash),
+		userSessionCacheKey(session.UserID),
+		userSessionCacheGenerationKey(session.UserID),
+	}
+	err := cacheSessionScript.Run(ctx, rdb, keys,
+		generation, buf.Bytes(), ttl.Milliseconds(), session.TokenHash, sessionCacheTTL.Milliseconds(),
+	).Err()
+	if err != nil {
+		log.Printf("error writing session cache: %v", err)
+	}
+}
+
+// WithoutCredentials returns the user without their password hash and TOTP secret, the form
+// that is cached and attached to requests. Handlers that check credentials reload the user
+// with FindUserCredentials.
+func WithoutCredentials(user models.User) models.User {
+	user.Password = ""
+	user.TOTPSecret = ""
+	return user
+}
+
+// FindUserCredentials reloads a user from the database, including their password hash and TOTP secret
+func FindUserCredentials(db *gorm.DB, userID uuid.UUID) (models.User, error) {
+	var user models.User
+	err := db.First(&user, "id = ?", userID).Error
+	return user, err
+}
+
+// InvalidateSessionCache drops the cached snapshot for one session digest
+func InvalidateSessionCache(ctx context.Context, digest string) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return
+	}
+
+	if err := rdb.Del(ctx, sessionCacheKey(digest)).Err(); err != nil {
+		log.Printf("error invalidating session cache: %v", err)
+	}
+}
+
+// InvalidateUserSessionCache drops every cached session of a user and bumps their cache
+// generation, so lookups already in flight do not cache what they read and access token
+// snapshots stamped with the old generation stop matching. Call it after
+// changing anything about the user, or revoking one of their sessions, once the change is
+// committed.
+func InvalidateUserSessionCache(ctx context.Context, userID uuid.UUID) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return
+	}
+
+	_, err := rdb.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Incr(ctx, userSessionCacheGenerationKey(userID))
+		pipe.Expire(ctx, userSessionCacheGenerationKey(userID), sessionCacheGenerationTTL)
+		return nil
+	})
+	if err != nil {
+		log.Printf("error invalidating session cache: %v", err)
+		return
+	}
+
+	digests, err := rdb.SMembers(ctx, userSessionCacheKey(userID)).Result()
+	if err != nil {
+		log.Printf("error invalidating session cache: %v", err)
+		return
+	}
+
+	keys := []string{userSessionCacheKey(userID)}
+	for _, digest := range digests {
+		keys = append(keys, sessionCacheKey(digest))
+	}
+	if err := rdb.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("error invalidating session cache: %v", err)
+	}
+}
+
+// TouchSession slides a session's expiry to now+slidingTTL, writing to the database only when
+// that extends it by at least interval. Expiry is never shortened, so long remember-me sessions
+// keep their lifetime, and impersonated sessions stay time-boxed. It reports the new expiry and whether it changed.
+func TouchSession(ctx context.Context, db *gorm.DB, session models.Session, slidingTTL time.Duration, interval time.Duration) (time.Time, bool, error) {
+	if session.ImpersonatorID != nil {
+		return session.ExpiresAt, false, nil
+	}
+
+	expiresAt := time.Now().Add(slidingTTL)
+	if expiresAt.Sub(session.ExpiresAt) < interval {
+		return session.ExpiresAt, false, nil
+	}
+
+	if err := db.Model(&session).Update("expires_at", expiresAt).Error; err != nil {
+		return session.ExpiresAt, false, err
+	}
+
+	// Drop the snapshot rather than rewrite it, since it may predate a change to the user
+	session.ExpiresAt = expiresAt
+	InvalidateSessionCache(ctx, session.TokenHash)
+
+	return expiresAt, true, nil
+}
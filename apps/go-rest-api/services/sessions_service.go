@@ -0,0 +1,235 @@
+package services
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	sessionTokenBytes          = 32
+	legacySessionBatchSize     = 500
+	sessionTokenPepperVariable = "SESSION_TOKEN_PEPPER"
+
+	// ReauthenticationWindow is how long after signing in a passwordless account can make sensitive changes
+	ReauthenticationWindow = 5 * time.Minute
+)
+
+// ErrSessionNotFound is returned for unknown or expired session tokens
+var ErrSessionNotFound = errors.New("session not found")
+
+var sessionTokenPepper = sync.OnceValue(func() []byte {
+	return []byte(os.Getenv(sessionTokenPepperVariable))
+})
+
+// HashSessionToken returns the digest stored for a session token. When SESSION_TOKEN_PEPPER
+// is set the digest is an HMAC keyed with it, so a leaked table cannot be checked offline.
+// Changing the pepper invalidates every existing session.
+func HashSessionToken(token string) string {
+	pepper := sessionTokenPepper()
+	if len(pepper) == 0 {
+		return HashToken(token)
+	}
+
+	mac := hmac.New(sha256.New, pepper)
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CreateSession stores a new session for the user and returns the raw token to hand to the client.
+// Signing in cancels any pending account deletion.
+func CreateSession(db *gorm.DB, userID uuid.UUID, ipAddress string, userAgent string, expiresAt time.Time) (string, models.Session, error) {
+	if err := CancelAccountDeletion(db, userID); err != nil {
+		return "", models.Session{}, err
+	}
+
+	now := time.Now()
+	return createSession(db, models.Session{
+		UserID:          userID,
+		ExpiresAt:       expiresAt,
+		IPAddress:       &ipAddress,
+		UserAgent:       &userAgent,
+		AuthenticatedAt: &now,
+	})
+}
+
+// CreateImpersonationSession stores a session that lets an admin act as the user until
+// expiresAt. Unlike CreateSession it leaves a pending account deletion alone.
+func CreateImpersonationSession(db *gorm.DB, impersonatorID uuid.UUID, userID uuid.UUID, ipAddress string, userAgent string, expiresAt time.Time, readOnly bool) (string, models.Session, error) {
+	return createSession(db, models.Session{
+		UserID:         userID,
+		ExpiresAt:      expiresAt,
+		IPAddress:      &ipAddress,
+		UserAgent:      &userAgent,
+		ImpersonatorID: &impersonatorID,
+		ReadOnly:       readOnly,
+	})
+}
+
+// createSession generates a token for the session and stores it
+func createSession(db *gorm.DB, session models.Session) (string, models.Session, error) {
+	token, err := GenerateToken(sessionTokenBytes)
+	if err != nil {
+		return "", models.Session{}, err
+	}
+
+	session.TokenHash = HashSessionToken(token)
+	if err := db.Create(&session).Error; err != nil {
+		return "", models.Session{}, err
+	}
+
+	return token, session, nil
+}
+
+// FindSession looks up an unexpired session and its user by raw token. Sessions created
+// before tokens were hashed are found by their plaintext token and converted on the spot.
+func FindSession(db *gorm.DB, token string) (models.Session, error) {
+	var session models.Session
+	if token == "" {
+		return session, ErrSessionNotFound
+	}
+
+	// Look up by digest
+	digest := HashSessionToken(token)
+	err := db.
+		Preload("User.Roles").
+		Where("token_hash = ? AND expires_at > ?", digest, time.Now()).
+		First(&session).Error
+	if err == nil {
+		return session, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, err
+	}
+
+	// Fall back to legacy plaintext tokens
+	err = db.
+		Preload("User.Roles").
+		Where("token = ? AND expires_at > ?", token, time.Now()).
+		First(&session).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return session, ErrSessionNotFound
+	}
+	if err != nil {
+		return session, err
+	}
+
+	// Convert the legacy session
+	if err := db.Model(&session).Updates(map[string]any{"token_hash": digest, "token": nil}).Error; err != nil {
+		return session, err
+	}
+	session.TokenHash = digest
+	session.Token = nil
+
+	return session, nil
+}
+
+// RecentlyAuthenticated reports whether the user proved who they are in this session within
+// ReauthenticationWindow, as accounts without a password must before sensitive changes
+func RecentlyAuthenticated(session models.Session) bool {
+	return session.AuthenticatedAt != nil && time.Since(*session.AuthenticatedAt) < ReauthenticationWindow
+}
+
+// MarkSessionAuthenticated records that the user just proved who they are in this session
+func MarkSessionAuthenticated(db *gorm.DB, session models.Session) error {
+	if err := db.Model(&session).Update("authenticated_at", time.Now()).Error; err != nil {
+		return err
+	}
+
+	InvalidateSessionCache(context.Background(), session.TokenHash)
+	return nil
+}
+
+// RevokeSessionByToken deletes the session identified by a raw token
+func RevokeSessionByToken(db *gorm.DB, token string) error {
+	digest := HashSessionToken(token)
+
+	var sessions []models.Session
+	err := db.
+		Clauses(clause.Returning{Columns: []clause.Column{{Name: "user_id"}}}).
+		Where("token_hash = ? OR token = ?", digest, token).
+		Delete(&sessions).Error
+	if err != nil {
+		return err
+	}
+
+	for _, session := range sessions {
+		InvalidateUserSessionCache(context.Background(), session.UserID)
+	}
+	return nil
+}
+
+// RevokeSession deletes a single session
+func RevokeSession(db *gorm.DB, session models.Session) error {
+	if err := db.Where("id = ?", session.ID).Delete(&models.Session{}).Error; err != nil {
+		return err
+	}
+
+	InvalidateUserSessionCache(context.Background(), session.UserID)
+	return nil
+}
+
+// RevokeUserSessions deletes every session of a user except the ones listed. It may run inside
+// a transaction, so the caller invalidates the user's session cache once the deletion commits.
+func RevokeUserSessions(db *gorm.DB, userID uuid.UUID, except ...uuid.UUID) (int64, error) {
+	query := db.Where("user_id = ?", userID)
+	if len(except) > 0 {
+		query = query.Where("id NOT IN ?", except)
+	}
+
+	result := query.Delete(&models.Session{})
+	if result.Error != nil {
+		return 0, result.Error
+	}
+
+	return result.RowsAffected, nil
+}
+
+// MigrateLegacySessionTokens hashes the plaintext tokens of sessions created before tokens
+// were hashed, in batches, so existing users stay signed in. Expired legacy sessions are deleted.
+func MigrateLegacySessionTokens(db *gorm.DB) (int, error) {
+	// Drop expired legacy sessions
+	if err := db.Where("token IS NOT NULL AND expires_at <= ?", time.Now()).Delete(&models.Session{}).Error; err != nil {
+		return 0, err
+	}
+
+	converted := 0
+	for {
+		// Load the next batch
+		var sessions []models.Session
+		if err := db.Where("token IS NOT NULL").Limit(legacySessionBatchSize).Find(&sessions).Error; err != nil {
+			return converted, err
+		}
+		if len(sessions) == 0 {
+			return converted, nil
+		}
+
+		// Replace each plaintext token with its digest
+		err := db.Transaction(func(tx *gorm.DB) error {
+			for _, session := range sessions {
+				if err := tx.Model(&session).Updates(map[string]any{
+					"token_hash": HashSessionToken(*session.Token),
+					"token":      nil,
+				}).Error; err != nil {
+					return err
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return converted, err
+		}
+		converted += len(sessions)
+	}
+}
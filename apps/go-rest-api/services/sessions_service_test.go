@@ -0,0 +1,34 @@
+package services
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+func TestRecentlyAuthenticated(t *testing.T) {
+	at := func(ago time.Duration) *time.Time {
+		t := time.Now().Add(-ago)
+		return &t
+	}
+
+	tests := []struct {
+		name    string
+		session models.Session
+		want    bool
+	}{
+		{name: "just signed in", session: models.Session{AuthenticatedAt: at(0)}, want: true},
+		{name: "inside the window", session: models.Session{AuthenticatedAt: at(ReauthenticationWindow - time.Minute)}, want: true},
+		{name: "outside the window", session: models.Session{AuthenticatedAt: at(ReauthenticationWindow + time.Minute)}},
+		{name: "never authenticated", session: models.Session{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RecentlyAuthenticated(tt.session); got != tt.want {
+				t.Errorf("RecentlyAuthenticated() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
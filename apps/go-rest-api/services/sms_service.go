@@ -0,0 +1,52 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// SMS is a text message addressed to an E.164 phone number
+type SMS struct {
+	To   string
+	Body string
+}
+
+// SMSSender delivers outgoing text messages
+type SMSSender interface {
+	Send(ctx context.Context, sms SMS) error
+}
+
+// ConsoleSMSSender writes text messages to the log and keeps them in memory, for tests and local development
+type ConsoleSMSSender struct {
+	mu   sync.Mutex
+	sent []SMS
+}
+
+func (s *ConsoleSMSSender) Send(ctx context.Context, sms SMS) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sent = append(s.sent, sms)
+	log.Printf("sms to=%s\n%s", sms.To, sms.Body)
+	return nil
+}
+
+// Sent returns a copy of every message sent so far
+func (s *ConsoleSMSSender) Sent() []SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]SMS(nil), s.sent...)
+}
+
+var smsSender SMSSender
+
+func InitSMSSender() error {
+	smsSender = &ConsoleSMSSender{}
+	return nil
+}
+
+func GetSMSSender() SMSSender {
+	return smsSender
+}
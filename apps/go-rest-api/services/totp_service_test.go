@@ -0,0 +1,90 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 seed from RFC 6238 Appendix B, "12345678901234567890", in base32
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCodeMatchesRFC6238Vectors(t *testing.T) {
+	// The RFC lists 8-digit codes; a 6-digit code is the same value modulo 10^6
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{unix: 59, code: "287082"},
+		{unix: 1111111109, code: "081804"},
+		{unix: 1111111111, code: "050471"},
+		{unix: 1234567890, code: "005924"},
+		{unix: 2000000000, code: "279037"},
+		{unix: 20000000000, code: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			code, err := TOTPCode(rfc6238Secret, TOTPStep(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if code != tt.code {
+				t.Errorf("TOTPCode at %d = %q, want %q", tt.unix, code, tt.code)
+			}
+		})
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	// 1111111109 falls in step 37037036, whose code is 081804
+	at := time.Unix(1111111109, 0)
+	step := TOTPStep(at)
+
+	tests := []struct {
+		name         string
+		code         string
+		at           time.Time
+		lastUsedStep int64
+		wantStep     int64
+		wantValid    bool
+	}{
+		{name: "current step", code: "081804", at: at, wantStep: step, wantValid: true},
+		{name: "one step late", code: "081804", at: at.Add(totpPeriod * time.Second), wantStep: step, wantValid: true},
+		{name: "one step early", code: "081804", at: at.Add(-totpPeriod * time.Second), wantStep: step, wantValid: true},
+		{name: "two steps late", code: "081804", at: at.Add(2 * totpPeriod * time.Second)},
+		{name: "two steps early", code: "081804", at: at.Add(-2 * totpPeriod * time.Second)},
+		{name: "surrounding whitespace", code: " 081804\n", at: at, wantStep: step, wantValid: true},
+		{name: "wrong code", code: "081805", at: at},
+		{name: "too short", code: "81804", at: at},
+		{name: "eight digits", code: "07081804", at: at},
+		{name: "step already used", code: "081804", at: at, lastUsedStep: step},
+		{name: "later step already used", code: "081804", at: at, lastUsedStep: step + 1},
+		{name: "earlier step used", code: "081804", at: at, lastUsedStep: step - 1, wantStep: step, wantValid: true},
+		{name: "already used within skew", code: "081804", at: at.Add(totpPeriod * time.Second), lastUsedStep: step},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, gotValid := ValidateTOTP(rfc6238Secret, tt.code, tt.at, tt.lastUsedStep)
+			if gotValid != tt.wantValid || gotStep != tt.wantStep {
+				t.Errorf("ValidateTOTP(%q) = %d, %v; want %d, %v", tt.code, gotStep, gotValid, tt.wantStep, tt.wantValid)
+			}
+		})
+	}
+}
+
+func TestValidateTOTPRejectsReplay(t *testing.T) {
+	at := time.Now()
+	code, err := TOTPCode(rfc6238Secret, TOTPStep(at))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	step, ok := ValidateTOTP(rfc6238Secret, code, at, 0)
+	if !ok {
+		t.Fatal("first use rejected")
+	}
+	if _, ok := ValidateTOTP(rfc6238Secret, code, at, step); ok {
+		t.Error("second use of the same code accepted")
+	}
+}
@@ -0,0 +1,112 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const (
+	MFAChallengeTTL         = 5 * time.Minute
+	MFAChallengeMaxAttempts = 5
+	recoveryCodeCount       = 10
+	recoveryCodeAlphabet    = "abcdefghijklmnopqrstuvwxyz234567"
+)
+
+// IssueMFAChallenge stores a short-lived challenge that stands in for a session until the
+// second factor is verified, carrying the sign-in options through to the session
+func IssueMFAChallenge(db *gorm.DB, userID uuid.UUID, rememberMe bool) (string, error) {
+	return issueVerificationToken(db, models.VerificationToken{
+		UserID:     userID,
+		Purpose:    models.VerificationTokenPurposeMFAChallenge,
+		RememberMe: rememberMe,
+	}, MFAChallengeTTL)
+}
+
+func normalizeRecoveryCode(code string) string {
+	return strings.ReplaceAll(strings.ToLower(strings.TrimSpace(code)), "-", "")
+}
+
+// ReplaceRecoveryCodes discards the user's recovery codes and stores a new set,
+// returning the codes to show to the user once
+func ReplaceRecoveryCodes(db *gorm.DB, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	records := make([]models.RecoveryCode, recoveryCodeCount)
+
+	for i := range codes {
+		b := make([]byte, 10)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = recoveryCodeAlphabet[b[j]&31]
+		}
+
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+		records[i] = models.RecoveryCode{
+			UserID:   userID,
+			CodeHash: HashToken(userID.String() + ":" + normalizeRecoveryCode(codes[i])),
+		}
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(&records).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// UseRecoveryCode redeems one of the user's unused recovery codes
+func UseRecoveryCode(db *gorm.DB, userID uuid.UUID, code string) (bool, error) {
+	result := db.Model(&models.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, HashToken(userID.String()+":"+normalizeRecoveryCode(code))).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// UseTOTPCode checks a TOTP code for the user and records its time step so it cannot be reused
+func UseTOTPCode(db *gorm.DB, user models.User, code string) (bool, error) {
+	if !user.IsTOTPEnabled || user.TOTPSecret == "" {
+		return false, nil
+	}
+
+	step, ok := ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastUsedStep)
+	if !ok {
+		return false, nil
+	}
+
+	// Guard against the same code being accepted concurrently
+	result := db.Model(&models.User{}).
+		Where("id = ? AND totp_last_used_step < ?", user.ID, step).
+		Update("totp_last_used_step", step)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		InvalidateUserSessionCache(context.Background(), user.ID)
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// VerifySecondFactor accepts either a TOTP code or a recovery code
+func VerifySecondFactor(db *gorm.DB, user models.User, code string, recoveryCode string) (bool, error) {
+	if recoveryCode != "" {
+		return UseRecoveryCode(db, user.ID, recoveryCode)
+	}
+	return UseTOTPCode(db, user, code)
+}
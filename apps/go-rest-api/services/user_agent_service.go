@@ -0,0 +1,83 @@
+package services
+
+import (
+	"regexp"
+	"strings"
+)
+
+// UserAgentInfo is a coarse description of the client behind a User-Agent header
+type UserAgentInfo struct {
+	Browser        string `json:"browser"`
+	BrowserVersion string `json:"browserVersion"`
+	OS             string `json:"os"`
+	DeviceType     string `json:"deviceType"`
+}
+
+var userAgentBrowsers = []struct {
+	name    string
+	pattern *regexp.Regexp
+}{
+	{"Edge", regexp.MustCompile(`Edg(?:e|A|iOS)?/([\d.]+)`)},
+	{"Opera", regexp.MustCompile(`(?:OPR|Opera)/([\d.]+)`)},
+	{"Samsung Internet", regexp.MustCompile(`SamsungBrowser/([\d.]+)`)},
+	{"Firefox", regexp.MustCompile(`(?:Firefox|FxiOS)/([\d.]+)`)},
+	{"Chrome", regexp.MustCompile(`(?:Chrome|CriOS)/([\d.]+)`)},
+	{"Safari", regexp.MustCompile(`Version/([\d.]+).*Safari/`)},
+}
+
+var userAgentOperatingSystems = []struct {
+	name   string
+	needle string
+}{
+	{"iOS", "iPhone"},
+	{"iPadOS", "iPad"},
+	{"Android", "Android"},
+	{"ChromeOS", "CrOS"},
+	{"Windows", "Windows"},
+	{"macOS", "Macintosh"},
+	{"Linux", "Linux"},
+}
+
+// ParseUserAgent extracts the browser, operating system and device type from a User-Agent header
+func ParseUserAgent(userAgent string) UserAgentInfo {
+	info := UserAgentInfo{
+		Browser:    "Unknown",
+		OS:         "Unknown",
+		DeviceType: "desktop",
+	}
+
+	if userAgent == "" {
+		info.DeviceType = "unknown"
+		return info
+	}
+
+	// Detect the browser
+	for _, b := range userAgentBrowsers {
+		if m := b.pattern.FindStringSubmatch(userAgent); m != nil {
+			info.Browser = b.name
+			info.BrowserVersion = m[1]
+			break
+		}
+	}
+
+	// Detect the operating system
+	for _, system := range userAgentOperatingSystems {
+		if strings.Contains(userAgent, system.needle) {
+			info.OS = system.name
+			break
+		}
+	}
+
+	// Detect the device type
+	lower := strings.ToLower(userAgent)
+	switch {
+	case strings.Contains(lower, "bot") || strings.Contains(lower, "crawler") || strings.Contains(lower, "spider"):
+		info.DeviceType = "bot"
+	case strings.Contains(lower, "ipad") || strings.Contains(lower, "tablet") || (strings.Contains(lower, "android") && !strings.Contains(lower, "mobile")):
+		info.DeviceType = "tablet"
+	case strings.Contains(lower, "mobi") || strings.Contains(lower, "iphone"):
+		info.DeviceType = "mobile"
+	}
+
+	return info
+}
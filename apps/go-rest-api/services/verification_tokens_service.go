@@ -0,0 +1,144 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+// ErrInvalidVerificationToken is returned for unknown, expired or already used tokens
+var ErrInvalidVerificationToken = errors.New("invalid or expired token")
+
+// GenerateToken returns a URL-safe random token with n bytes of entropy
+func GenerateToken(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// HashToken returns the hex-encoded SHA-256 digest of a token
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IssueVerificationToken invalidates any outstanding tokens for the same purpose and
+// stores a new one, returning the raw token to send to the user
+func IssueVerificationToken(db *gorm.DB, userID uuid.UUID, purpose string, ttl time.Duration) (string, error) {
+	return issueVerificationToken(db, models.VerificationToken{UserID: userID, Purpose: purpose}, ttl)
+}
+
+func issueVerificationToken(db *gorm.DB, record models.VerificationToken, ttl time.Duration) (string, error) {
+	token, err := GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	err = db.Transaction(func(tx *gorm.DB) error {
+		// Invalidate previous tokens
+		if err := tx.Model(&models.VerificationToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", record.UserID, record.Purpose).
+			Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		// Store the new token
+		record.TokenHash = HashToken(token)
+		record.ExpiresAt = now.Add(ttl)
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return token, nil
+}
+
+// IssueEmailChangeToken stores a token confirming that the user controls a new email address
+func IssueEmailChangeToken(db *gorm.DB, userID uuid.UUID, email string, ttl time.Duration) (string, error) {
+	return issueVerificationToken(db, models.VerificationToken{
+		UserID:  userID,
+		Purpose: models.VerificationTokenPurposeEmailChange,
+		Email:   email,
+	}, ttl)
+}
+
+// IssueMagicLinkToken stores a single-use sign-in token, carrying the remember-me option
+// through to the session
+func IssueMagicLinkToken(db *gorm.DB, userID uuid.UUID, rememberMe bool, ttl time.Duration) (string, error) {
+	return issueVerificationToken(db, models.VerificationToken{
+		UserID:     userID,
+		Purpose:    models.VerificationTokenPurposeMagicLink,
+		RememberMe: rememberMe,
+	}, ttl)
+}
+
+// FindVerificationToken returns an outstanding token and its user without redeeming it
+func FindVerificationToken(db *gorm.DB, token string, purpose string) (models.VerificationToken, error) {
+	var record models.VerificationToken
+	if token == "" {
+		return record, ErrInvalidVerificationToken
+	}
+
+	err := db.
+		Preload("User").
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), purpose, time.Now()).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrInvalidVerificationToken
+	}
+	return record, err
+}
+
+// RecordVerificationTokenFailure counts a failed attempt against a token and
+// invalidates it once maxAttempts is reached
+func RecordVerificationTokenFailure(db *gorm.DB, record models.VerificationToken, maxAttempts int) error {
+	return db.Model(&models.VerificationToken{}).
+		Where("id = ?", record.ID).
+		Updates(map[string]any{
+			"attempts": gorm.Expr("attempts + 1"),
+			"used_at":  gorm.Expr("CASE WHEN attempts + 1 >= ? THEN ? ELSE used_at END", maxAttempts, time.Now()),
+		}).Error
+}
+
+// ConsumeVerificationToken marks a token as used and returns it, so it can be redeemed only once
+func ConsumeVerificationToken(db *gorm.DB, token string, purpose string) (models.VerificationToken, error) {
+	var record models.VerificationToken
+	if token == "" {
+		return record, ErrInvalidVerificationToken
+	}
+
+	// Find the token
+	now := time.Now()
+	err := db.
+		Where("token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?", HashToken(token), purpose, now).
+		First(&record).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return record, ErrInvalidVerificationToken
+	}
+	if err != nil {
+		return record, err
+	}
+
+	// Mark the token as used, guarding against concurrent redemption
+	result := db.Model(&record).Where("used_at IS NULL").Update("used_at", now)
+	if result.Error != nil {
+		return record, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return record, ErrInvalidVerificationToken
+	}
+
+	return record, nil
+}
@@ -0,0 +1,198 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/spanhornet/brambles/packages/database/models"
+)
+
+const webAuthnCeremonyTTL = 5 * time.Minute
+
+// ErrWebAuthnCeremonyNotFound is returned for unknown, expired or already finished ceremonies
+var ErrWebAuthnCeremonyNotFound = errors.New("ceremony not found")
+
+var webAuthnClient *webauthn.WebAuthn
+
+func InitWebAuthn() error {
+	// Set WebAuthn configuration
+	rpID := os.Getenv("WEBAUTHN_RP_ID")
+	rpDisplayName := os.Getenv("WEBAUTHN_RP_DISPLAY_NAME")
+	rpOrigins := os.Getenv("WEBAUTHN_RP_ORIGINS")
+
+	if rpID == "" {
+		rpID = "localhost"
+	}
+	if rpDisplayName == "" {
+		rpDisplayName = "Brambles"
+	}
+	if rpOrigins == "" {
+		rpOrigins = "http://localhost:3000"
+	}
+
+	// Initialize the relying party
+	client, err := webauthn.New(&webauthn.Config{
+		RPID:          rpID,
+		RPDisplayName: rpDisplayName,
+		RPOrigins:     strings.Split(rpOrigins, ","),
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnCeremonyTTL},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: webAuthnCeremonyTTL},
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	webAuthnClient = client
+	return nil
+}
+
+func GetWebAuthn() *webauthn.WebAuthn {
+	return webAuthnClient
+}
+
+// WebAuthnUser adapts a user and their passkeys to the webauthn.User interface
+type WebAuthnUser struct {
+	User        models.User
+	Credentials []models.Credential
+}
+
+func (u WebAuthnUser) WebAuthnID() []byte {
+	return u.User.ID[:]
+}
+
+func (u WebAuthnUser) WebAuthnName() string {
+	return u.User.Email
+}
+
+func (u WebAuthnUser) WebAuthnDisplayName() string {
+	return strings.TrimSpace(u.User.FirstName + " " + u.User.LastName)
+}
+
+func (u WebAuthnUser) WebAuthnCredentials() []webauthn.Credential {
+	credentials := make([]webauthn.Credential, 0, len(u.Credentials))
+	for _, c := range u.Credentials {
+		credentials = append(credentials, ToWebAuthnCredential(c))
+	}
+	return credentials
+}
+
+// ToWebAuthnCredential converts a stored passkey into its webauthn representation
+func ToWebAuthnCredential(c models.Credential) webauthn.Credential {
+	var transports []protocol.AuthenticatorTransport
+	for _, t := range strings.Split(c.Transports, ",") {
+		if t != "" {
+			transports = append(transports, protocol.AuthenticatorTransport(t))
+		}
+	}
+
+	return webauthn.Credential{
+		ID:              c.CredentialID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transport:       transports,
+		Flags:           webauthn.NewCredentialFlags(protocol.AuthenticatorFlags(c.Flags)),
+		Authenticator: webauthn.Authenticator{
+			AAGUID:       c.AAGUID,
+			SignCount:    uint32(c.SignCount),
+			CloneWarning: c.CloneWarning,
+		},
+	}
+}
+
+// FromWebAuthnCredential converts a newly registered webauthn credential into a stored passkey
+func FromWebAuthnCredential(userID uuid.UUID, name string, c webauthn.Credential) models.Credential {
+	transports := make([]string, 0, len(c.Transport))
+	for _, t := range c.Transport {
+		transports = append(transports, string(t))
+	}
+
+	return models.Credential{
+		UserID:          userID,
+		Name:            name,
+		CredentialID:    c.ID,
+		PublicKey:       c.PublicKey,
+		AttestationType: c.AttestationType,
+		Transports:      strings.Join(transports, ","),
+		AAGUID:          c.Authenticator.AAGUID,
+		SignCount:       int64(c.Authenticator.SignCount),
+		CloneWarning:    c.Authenticator.CloneWarning,
+		Flags:           int16(c.Flags.ProtocolValue()),
+	}
+}
+
+// WebAuthnCeremony is the server-side state kept between the begin and finish steps of a ceremony
+type WebAuthnCeremony struct {
+	Session    webauthn.SessionData `json:"session"`
+	UserID     uuid.UUID            `json:"userId"`
+	RememberMe bool                 `json:"rememberMe"`
+
+	// Pending account details for passkey-only sign-up
+	FirstName string `json:"firstName,omitempty"`
+	LastName  string `json:"lastName,omitempty"`
+	Email     string `json:"email,omitempty"`
+	Phone     string `json:"phone,omitempty"`
+}
+
+func webAuthnCeremonyKey(id string) string {
+	return "webauthn_ceremony:" + id
+}
+
+// SaveWebAuthnCeremony stores ceremony state and returns the ID the client echoes back when finishing
+func SaveWebAuthnCeremony(ctx context.Context, ceremony WebAuthnCeremony) (string, error) {
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return "", errors.New("Redis client not initialized")
+	}
+
+	id, err := GenerateToken(32)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(ceremony)
+	if err != nil {
+		return "", fmt.Errorf("could not serialize ceremony: %w", err)
+	}
+
+	if err := rdb.Set(ctx, webAuthnCeremonyKey(id), payload, webAuthnCeremonyTTL).Err(); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+// TakeWebAuthnCeremony loads and deletes ceremony state, so each ceremony can be finished only once
+func TakeWebAuthnCeremony(ctx context.Context, id string) (WebAuthnCeremony, error) {
+	var ceremony WebAuthnCeremony
+
+	rdb := GetRedisCloudClient()
+	if rdb == nil {
+		return ceremony, errors.New("Redis client not initialized")
+	}
+
+	payload, err := rdb.GetDel(ctx, webAuthnCeremonyKey(id)).Bytes()
+	if errors.Is(err, redis.Nil) {
+		return ceremony, ErrWebAuthnCeremonyNotFound
+	}
+	if err != nil {
+		return ceremony, err
+	}
+
+	if err := json.Unmarshal(payload, &ceremony); err != nil {
+		return ceremony, fmt.Errorf("could not deserialize ceremony: %w", err)
+	}
+
+	return ceremony, nil
+}
@@ -0,0 +1,202 @@
+package validators
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Password strength scores, from trivially guessable to very strong
+const (
+	PasswordScoreVeryWeak = iota
+	PasswordScoreWeak
+	PasswordScoreFair
+	PasswordScoreStrong
+	PasswordScoreVeryStrong
+)
+
+// PasswordPolicy decides which passwords may be set
+type PasswordPolicy struct {
+	MinLength int
+	MaxBytes  int
+	MinScore  int
+	// Breached reports whether a password appears in a known data breach; nil skips the check
+	Breached func(password string) bool
+}
+
+// DefaultPasswordPolicy is the policy applied by Password
+var DefaultPasswordPolicy = PasswordPolicy{
+	MinLength: MinPasswordLength,
+	MaxBytes:  MaxPasswordBytes,
+	MinScore:  PasswordScoreFair,
+}
+
+// Validate checks a password against the policy. userInputs are values the user has already
+// given, such as their name and email, which make a password easier to guess when reused.
+func (p PasswordPolicy) Validate(errs Errors, field string, password string, userInputs ...string) {
+	if utf8.RuneCountInString(password) < p.MinLength {
+		errs.Add(field, fmt.Sprintf("password must be at least %d characters", p.MinLength))
+		return
+	}
+	if len(password) > p.MaxBytes {
+		errs.Add(field, fmt.Sprintf("password must be at most %d bytes", p.MaxBytes))
+		return
+	}
+	if PasswordStrength(password, userInputs...) < p.MinScore {
+		errs.Add(field, "password is too easy to guess; use a longer phrase or avoid repeats, sequences and personal details")
+		return
+	}
+	if p.Breached != nil && p.Breached(password) {
+		errs.Add(field, "password has appeared in a data breach; choose a different password")
+	}
+}
+
+// Password checks a password against the default password policy
+func Password(errs Errors, field string, password string, userInputs ...string) {
+	DefaultPasswordPolicy.Validate(errs, field, password, userInputs...)
+}
+
+// passwordCharsetBits estimates the bits an attacker must guess per character, from the
+// character classes the password draws on
+func passwordCharsetBits(password string) float64 {
+	var lower, upper, digit, symbol, other bool
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			lower = true
+		case r >= 'A' && r <= 'Z':
+			upper = true
+		case r >= '0' && r <= '9':
+			digit = true
+		case r < unicode.MaxASCII && unicode.IsPrint(r):
+			symbol = true
+		default:
+			other = true
+		}
+	}
+
+	pool := 0
+	for _, class := range []struct {
+		present bool
+		size    int
+	}{{lower, 26}, {upper, 26}, {digit, 10}, {symbol, 33}, {other, 100}} {
+		if class.present {
+			pool += class.size
+		}
+	}
+	return math.Log2(float64(max(pool, 2)))
+}
+
+// commonPasswordWords top every list of leaked passwords. Like the user's own details, each
+// counts as a single guess, even dressed up with the substitutions in leetSubstitutions.
+var commonPasswordWords = []string{
+	"password", "passwort", "passw", "letmein", "welcome", "qwerty", "qwertz", "azerty",
+	"asdf", "zxcv", "admin", "login", "master", "secret", "iloveyou", "love", "monkey",
+	"dragon", "shadow", "sunshine", "princess", "football", "baseball", "soccer", "hockey",
+	"superman", "batman", "trustno", "whatever", "freedom", "hello", "charlie", "michael",
+	"jordan", "summer", "winter", "spring", "autumn", "january", "february", "october",
+	"december", "computer", "internet", "changeme", "default", "test", "user",
+}
+
+// leetSubstitutions maps characters commonly swapped into words back to the letters they replace
+var leetSubstitutions = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '@': 'a', '$': 's',
+}
+
+// markPredictable flags every occurrence of token in runes
+func markPredictable(predictable []bool, runes []rune, token string) {
+	t := []rune(token)
+	for i := 0; i+len(t) <= len(runes); i++ {
+		if string(runes[i:i+len(t)]) == token {
+			for j := i; j < i+len(t); j++ {
+				predictable[j] = true
+			}
+		}
+	}
+}
+
+// markYears flags four-digit years from 1900 to 2099, which people append to meet digit rules
+func markYears(predictable []bool, runes []rune) {
+	for i := 0; i+4 <= len(runes); i++ {
+		century := string(runes[i : i+2])
+		if (century == "19" || century == "20") && unicode.IsDigit(runes[i+2]) && unicode.IsDigit(runes[i+3]) {
+			for j := i; j < i+4; j++ {
+				predictable[j] = true
+			}
+		}
+	}
+}
+
+// userInputTokens splits the user's own details into lowercase words worth looking for
+func userInputTokens(userInputs []string) []string {
+	var tokens []string
+	for _, input := range userInputs {
+		for _, token := range strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		}) {
+			if utf8.RuneCountInString(token) >= 3 {
+				tokens = append(tokens, token)
+			}
+		}
+	}
+	return tokens
+}
+
+// PasswordStrength scores a password from PasswordScoreVeryWeak to PasswordScoreVeryStrong by
+// estimating its entropy. Repeated and sequential characters, such as "aaaa" or "1234", parts
+// of the user's own details, common password words and years count as a single guess each.
+func PasswordStrength(password string, userInputs ...string) int {
+	lowered := []rune(strings.ToLower(password))
+
+	// Undo character substitutions for the common word check
+	plain := make([]rune, len(lowered))
+	for i, r := range lowered {
+		if letter, ok := leetSubstitutions[r]; ok {
+			r = letter
+		}
+		plain[i] = r
+	}
+
+	// Mark characters taken from the user's details, common words and years
+	predictable := make([]bool, len(lowered))
+	for _, token := range userInputTokens(userInputs) {
+		markPredictable(predictable, lowered, token)
+	}
+	for _, word := range commonPasswordWords {
+		markPredictable(predictable, plain, word)
+	}
+	markYears(predictable, lowered)
+
+	charBits := passwordCharsetBits(password)
+
+	var bits float64
+	for i, r := range lowered {
+		switch {
+		case predictable[i]:
+			// Guessed along with the rest of the detail
+			if i == 0 || !predictable[i-1] {
+				bits++
+			}
+		case i > 0 && (r == lowered[i-1] || r == lowered[i-1]+1 || r == lowered[i-1]-1):
+			// Continues a run or sequence
+			bits++
+		default:
+			bits += charBits
+		}
+	}
+
+	switch {
+	case bits < 28:
+		return PasswordScoreVeryWeak
+	case bits < 36:
+		return PasswordScoreWeak
+	case bits < 60:
+		return PasswordScoreFair
+	case bits < 80:
+		return PasswordScoreStrong
+	default:
+		return PasswordScoreVeryStrong
+	}
+}
@@ -0,0 +1,75 @@
+package validators
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPasswordStrength(t *testing.T) {
+	tests := []struct {
+		password   string
+		userInputs []string
+		want       int
+	}{
+		// Common words, dressed up or not, with predictable digits and symbols
+		{password: "Password123!", want: PasswordScoreVeryWeak},
+		{password: "P@ssw0rd2024", want: PasswordScoreVeryWeak},
+		{password: "Welcome1!", want: PasswordScoreVeryWeak},
+		{password: "Summer2024!", want: PasswordScoreVeryWeak},
+		{password: "iloveyou2024", want: PasswordScoreVeryWeak},
+		{password: "qwerty123456", want: PasswordScoreVeryWeak},
+
+		// Repeats and sequences
+		{password: "aaaaaaaaaaaa", want: PasswordScoreVeryWeak},
+		{password: "123456789012", want: PasswordScoreVeryWeak},
+		{password: "abcdefghijkl", want: PasswordScoreVeryWeak},
+
+		// The user's own details
+		{password: "JaneDoe1990!", userInputs: []string{"Jane", "Doe", "jane.doe@example.com"}, want: PasswordScoreVeryWeak},
+		{password: "JaneDoe1990!", want: PasswordScoreFair},
+
+		// Hard to guess
+		{password: "tG7#kq9!Vx2m", want: PasswordScoreStrong},
+		{password: "correct horse battery staple", want: PasswordScoreVeryStrong},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.password, func(t *testing.T) {
+			if got := PasswordStrength(tt.password, tt.userInputs...); got != tt.want {
+				t.Errorf("PasswordStrength(%q) = %d, want %d", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPasswordPolicyValidate(t *testing.T) {
+	policy := DefaultPasswordPolicy
+	policy.Breached = func(password string) bool { return password == "leaked but long and random enough 7#" }
+
+	tests := []struct {
+		name     string
+		password string
+		want     string
+	}{
+		{name: "too short", password: "tG7#kq9", want: "at least"},
+		{name: "too long", password: strings.Repeat("x", policy.MaxBytes+1), want: "at most"},
+		{name: "easy to guess", password: "Password123!", want: "too easy to guess"},
+		{name: "breached", password: "leaked but long and random enough 7#", want: "data breach"},
+		{name: "accepted", password: "correct horse battery staple"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			errs := Errors{}
+			policy.Validate(errs, "password", tt.password, "Jane", "Doe")
+
+			got := errs["password"]
+			if tt.want == "" && got != "" {
+				t.Fatalf("unexpected error %q", got)
+			}
+			if !strings.Contains(got, tt.want) {
+				t.Fatalf("error = %q, want it to mention %q", got, tt.want)
+			}
+		})
+	}
+}
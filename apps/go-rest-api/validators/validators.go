@@ -0,0 +1,116 @@
+package validators
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+const (
+	MinPasswordLength = 8
+	MaxPasswordBytes  = 72 // bcrypt ignores anything longer
+	MaxNameLength     = 100
+	MaxEmailLength    = 254
+)
+
+var (
+	e164Pattern         = regexp.MustCompile(`^\+[1-9][0-9]{6,14}$`)
+	phoneSeparatorsExpr = regexp.MustCompile(`[\s().-]`)
+)
+
+// Errors collects validation messages keyed by field name
+type Errors map[string]string
+
+// Add records a message for a field, keeping the first message per field
+func (e Errors) Add(field string, message string) {
+	if _, ok := e[field]; !ok {
+		e[field] = message
+	}
+}
+
+// Empty reports whether no field failed validation
+func (e Errors) Empty() bool {
+	return len(e) == 0
+}
+
+// NormalizeEmail trims and lowercases an email address
+func NormalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// NormalizePhone strips common formatting characters from a phone number
+func NormalizePhone(phone string) string {
+	return phoneSeparatorsExpr.ReplaceAllString(strings.TrimSpace(phone), "")
+}
+
+// Email checks that a normalized address is a bare, syntactically valid email
+func Email(errs Errors, field string, email string) {
+	if email == "" {
+		errs.Add(field, "email is required")
+		return
+	}
+	if len(email) > MaxEmailLength {
+		errs.Add(field, fmt.Sprintf("email must be at most %d characters", MaxEmailLength))
+		return
+	}
+
+	address, err := mail.ParseAddress(email)
+	if err != nil || address.Address != email || address.Name != "" {
+		errs.Add(field, "email is not a valid address")
+		return
+	}
+
+	_, domain, _ := strings.Cut(email, "@")
+	if !strings.Contains(domain, ".") || strings.HasPrefix(domain, ".") || strings.HasSuffix(domain, ".") {
+		errs.Add(field, "email is not a valid address")
+	}
+}
+
+// Phone checks that a normalized phone number is in E.164 format
+func Phone(errs Errors, field string, phone string) {
+	if phone == "" {
+		errs.Add(field, "phone is required")
+		return
+	}
+	if !e164Pattern.MatchString(phone) {
+		errs.Add(field, "phone must be in international format, e.g. +14155552671")
+	}
+}
+
+// Name checks that a trimmed name is present and not too long
+func Name(errs Errors, field string, name string) {
+	Length(errs, field, name, 1, MaxNameLength)
+}
+
+// Length checks that a trimmed value has between min and max characters
+func Length(errs Errors, field string, value string, min int, max int) {
+	n := utf8.RuneCountInString(strings.TrimSpace(value))
+	switch {
+	case n < min && min == 1:
+		errs.Add(field, field+" is required")
+	case n < min:
+		errs.Add(field, fmt.Sprintf("%s must be at least %d characters", field, min))
+	case n > max:
+		errs.Add(field, fmt.Sprintf("%s must be at most %d characters", field, max))
+	}
+}
+
+// UniqueViolation reports the column behind a unique constraint violation, relying on
+// GORM's idx_<table>_<column> index naming
+func UniqueViolation(err error) (string, bool) {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != "23505" {
+		return "", false
+	}
+
+	name := strings.TrimPrefix(pgErr.ConstraintName, "idx_")
+	if pgErr.TableName != "" {
+		name = strings.TrimPrefix(name, pgErr.TableName+"_")
+	}
+	return name, true
+}
@@ -1,5 +1,5 @@
 // Utilites
-import { api } from '@/lib/api-handler';
+import { api, csrfHeaders, isCsrfRejection } from '@/lib/api-handler';
 
 // React Query
 import { useQuery, useMutation, useQueryClient } from '@tanstack/react-query';
@@ -29,18 +29,28 @@ export function useDocuments(chatId?: string) {
 
   const createDocumentMutation = useMutation({
     mutationFn: async (formData: FormData) => {
-      const response = await fetch(`${process.env.NEXT_PUBLIC_API_URL}/api/v1/documents`, {
-        method: 'POST',
-        body: formData,
-        credentials: 'include',
-      });
+      const upload = async (refreshCsrf = false) =>
+        fetch(`${process.env.NEXT_PUBLIC_API_URL}/api/v1/documents`, {
+          method: 'POST',
+          body: formData,
+          headers: await csrfHeaders(refreshCsrf),
+          credentials: 'include',
+        });
+
+      let response = await upload();
+      let body = await response.json().catch(() => ({}));
+
+      // Retry once with a fresh CSRF token if the session changed
+      if (isCsrfRejection(response.status, body)) {
+        response = await upload(true);
+        body = await response.json().catch(() => ({}));
+      }
 
       if (!response.ok) {
-        const error = await response.json().catch(() => ({}));
-        throw new Error(error?.error || 'Failed to upload document');
+        throw new Error(body?.error || 'Failed to upload document');
       }
 
-      return response.json();
+      return body;
     },
     onSuccess: () => {
       queryClient.invalidateQueries({ queryKey: ['documents'] });
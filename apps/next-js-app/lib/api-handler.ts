@@ -8,6 +8,44 @@ export interface FetchOptions extends RequestInit {
 
 const API_URL = process.env.NEXT_PUBLIC_API_URL ?? '';
 
+const CSRF_HEADER = 'X-CSRF-Token';
+const SAFE_METHODS: RequestMethod[] = ['GET', 'OPTIONS'];
+
+// The CSRF token is derived from the session, so it is cached until a request is rejected
+let csrfToken: Promise<string | null> | null = null;
+
+async function fetchCsrfToken(): Promise<string | null> {
+  try {
+    const response = await fetch(new URL('/api/v1/csrf', API_URL).toString(), {
+      credentials: 'include',
+    });
+    if (!response.ok) return null;
+
+    const body = (await response.json()) as { csrfToken?: string | null };
+    return body.csrfToken || null;
+  } catch {
+    return null;
+  }
+}
+
+// Headers a state-changing request needs to pass the API's CSRF check
+export async function csrfHeaders(refresh = false): Promise<Record<string, string>> {
+  if (refresh || !csrfToken) {
+    csrfToken = fetchCsrfToken();
+  }
+
+  const token = await csrfToken;
+  return token ? { [CSRF_HEADER]: token } : {};
+}
+
+// Whether a response is the API rejecting a stale or missing CSRF token
+export function isCsrfRejection(status: number, body: unknown): boolean {
+  return (
+    status === 403 &&
+    (body as { error?: string } | null)?.error === 'invalid CSRF token'
+  );
+}
+
 export class ApiError extends Error {
   constructor(
     public status: number,
@@ -50,29 +88,30 @@ export async function apiRequest<T>(
     );
   }
 
-  // Set headers
-  const headers: HeadersInit = {
-    'Content-Type': 'application/json',
-    ...customOptions.headers,
-  };
+  const safe = SAFE_METHODS.includes(method);
+
+  // Set fetch options, echoing the CSRF token on state-changing requests
+  const buildOptions = async (refreshCsrf = false): Promise<RequestInit> => {
+    const fetchOptions: RequestInit = {
+      ...customOptions,
+      method,
+      headers: {
+        'Content-Type': 'application/json',
+        ...(safe ? {} : await csrfHeaders(refreshCsrf)),
+        ...customOptions.headers,
+      },
+      credentials: 'include',
+    };
+
+    // Set body
+    if (payload && method !== 'GET') {
+      fetchOptions.body = JSON.stringify(payload);
+    }
 
-  // Set fetch options
-  const fetchOptions: RequestInit = {
-    ...customOptions,
-    method,
-    headers,
-    credentials: 'include',
+    return fetchOptions;
   };
 
-  // Set body
-  if (payload && method !== 'GET') {
-    fetchOptions.body = JSON.stringify(payload);
-  }
-
-  let data: T | null = null;
-  let error: ApiError | null = null;
-
-  try {
+  const send = async (fetchOptions: RequestInit) => {
     const response = await fetch(url.toString(), fetchOptions);
 
     let body: unknown | null = null;
@@ -82,6 +121,20 @@ export async function apiRequest<T>(
       body = null;
     }
 
+    return { response, body };
+  };
+
+  let data: T | null = null;
+  let error: ApiError | null = null;
+
+  try {
+    let { response, body } = await send(await buildOptions());
+
+    // The session changed since the token was fetched; fetch a new one and retry once
+    if (!safe && isCsrfRejection(response.status, body)) {
+      ({ response, body } = await send(await buildOptions(true)));
+    }
+
     if (!response.ok) {
       error = new ApiError(response.status, response.statusText, body);
     } else {
@@ -2,6 +2,7 @@ package database
 
 import (
 	"fmt"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
@@ -23,11 +24,30 @@ func ConnectToDatabase(dsn string) (*gorm.DB, error) {
 }
 
 func Migrate(db *gorm.DB) error {
-	return db.AutoMigrate(
+	err := db.AutoMigrate(
+		&models.APIToken{},
+		&models.AuditEvent{},
 		&models.Chat{},
+		&models.Credential{},
+		&models.DataExport{},
 		&models.Document{},
+		&models.Identity{},
+		&models.Invitation{},
+		&models.Membership{},
 		&models.Message{},
+		&models.Organization{},
+		&models.OrphanedObject{},
+		&models.RecoveryCode{},
+		&models.RefreshToken{},
+		&models.Role{},
 		&models.Session{},
 		&models.User{},
+		&models.VerificationToken{},
 	)
+	if err != nil {
+		return err
+	}
+
+	// Users.DeletedAt used to be a plain time, so live rows hold the zero time instead of NULL
+	return db.Exec("UPDATE users SET deleted_at = NULL WHERE deleted_at = ?", time.Time{}).Error
 }
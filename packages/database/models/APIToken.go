@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	ScopeChatsRead      = "chats:read"
+	ScopeChatsWrite     = "chats:write"
+	ScopeDocumentsRead  = "documents:read"
+	ScopeDocumentsWrite = "documents:write"
+)
+
+// Scopes lists every scope an API token can be granted
+var Scopes = []string{
+	ScopeChatsRead,
+	ScopeChatsWrite,
+	ScopeDocumentsRead,
+	ScopeDocumentsWrite,
+}
+
+// APIToken is a named, revocable personal access token for scripts and API clients
+type APIToken struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+	ExpiresAt  *time.Time
+	LastUsedAt *time.Time
+	RevokedAt  *time.Time
+
+	Name      string   `gorm:"size:255;not null"`
+	Prefix    string   `gorm:"size:16;not null"`
+	TokenHash string   `gorm:"size:64;uniqueIndex;not null"`
+	Scopes    []string `gorm:"type:jsonb;serializer:json;not null"`
+}
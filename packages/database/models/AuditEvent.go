@@ -0,0 +1,39 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditActionSignUp             = "user.sign_up"
+	AuditActionSignIn             = "user.sign_in"
+	AuditActionSignInFailed       = "user.sign_in_failed"
+	AuditActionSignOut            = "user.sign_out"
+	AuditActionSessionRevoked     = "session.revoked"
+	AuditActionDocumentUploaded   = "document.uploaded"
+	AuditActionDocumentEnqueued   = "document.enqueued"
+	AuditActionChatCreated        = "chat.created"
+	AuditActionImpersonation      = "admin.impersonation_started"
+	AuditActionRefreshTokenReused = "session.refresh_token_reused"
+)
+
+// AuditEvent records who did what, and when. Actor and target IDs are deliberately not foreign
+// keys so the trail outlives the rows it describes.
+type AuditEvent struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime;index"`
+
+	Action  string     `gorm:"size:64;not null;index"`
+	ActorID *uuid.UUID `gorm:"type:uuid;index"`
+
+	IPAddress string `gorm:"type:text"`
+	UserAgent string `gorm:"type:text"`
+
+	TargetType string     `gorm:"size:32"`
+	TargetID   *uuid.UUID `gorm:"type:uuid;index"`
+
+	Metadata map[string]any `gorm:"type:jsonb;serializer:json"`
+}
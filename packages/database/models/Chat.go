@@ -11,6 +11,9 @@ type Chat struct {
 	ID     uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
 	UserID uuid.UUID `gorm:"type:uuid;not null"`
 
+	// OrganizationID is set for chats shared with a workspace
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index"`
+
 	CreatedAt time.Time
 	UpdatedAt time.Time
 	DeletedAt gorm.DeletedAt `gorm:"index"`
@@ -0,0 +1,31 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Credential is a WebAuthn public key credential (passkey) registered to a user
+type Credential struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	UpdatedAt  time.Time `gorm:"autoUpdateTime"`
+	LastUsedAt *time.Time
+
+	Name string `gorm:"size:255"`
+
+	CredentialID    []byte `gorm:"type:bytea;uniqueIndex;not null"`
+	PublicKey       []byte `gorm:"type:bytea;not null"`
+	AttestationType string `gorm:"size:64"`
+	Transports      string `gorm:"size:255"`
+
+	AAGUID       []byte `gorm:"type:bytea"`
+	SignCount    int64  `gorm:"not null;default:0"`
+	CloneWarning bool   `gorm:"default:false"`
+	Flags        int16  `gorm:"not null;default:0"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DataExportStatusPending   = "pending"
+	DataExportStatusRunning   = "running"
+	DataExportStatusCompleted = "completed"
+	DataExportStatusFailed    = "failed"
+)
+
+// DataExport is an archive of everything stored about a user, built in the background
+type DataExport struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+	CompletedAt *time.Time
+	ExpiresAt   *time.Time
+
+	Status string `gorm:"size:16;not null;index"`
+	Error  string `gorm:"type:text"`
+
+	// Bucket and ObjectKey locate the archive once the export has completed
+	Bucket    string `gorm:"size:63"`
+	ObjectKey string `gorm:"size:1024"`
+	Size      int64
+}
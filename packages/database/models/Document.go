@@ -12,6 +12,9 @@ type Document struct {
 	UserID uuid.UUID `gorm:"type:uuid;index"`
 	ChatID uuid.UUID `gorm:"type:uuid;index"`
 
+	// OrganizationID is copied from the chat the document was uploaded to
+	OrganizationID *uuid.UUID `gorm:"type:uuid;index"`
+
 	CreatedAt time.Time      `gorm:"autoCreateTime"`
 	UpdatedAt time.Time      `gorm:"autoUpdateTime"`
 	DeletedAt gorm.DeletedAt `gorm:"index"`
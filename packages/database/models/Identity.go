@@ -0,0 +1,23 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Identity links an account at an external OpenID Connect provider to a user
+type Identity struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt   time.Time `gorm:"autoCreateTime"`
+	UpdatedAt   time.Time `gorm:"autoUpdateTime"`
+	LastLoginAt *time.Time
+
+	Provider string `gorm:"size:64;not null;uniqueIndex:idx_provider_subject"`
+	Subject  string `gorm:"size:255;not null;uniqueIndex:idx_provider_subject"`
+	Email    string `gorm:"size:255"`
+}
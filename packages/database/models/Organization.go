@@ -0,0 +1,69 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	MembershipRoleOwner  = "owner"
+	MembershipRoleAdmin  = "admin"
+	MembershipRoleMember = "member"
+)
+
+// MembershipRoles lists the roles a member can hold, from least to most privileged
+var MembershipRoles = []string{
+	MembershipRoleMember,
+	MembershipRoleAdmin,
+	MembershipRoleOwner,
+}
+
+// Organization is a workspace whose chats and documents are shared by its members
+type Organization struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	Name string `gorm:"size:255;not null"`
+
+	Memberships []Membership `gorm:"constraint:OnDelete:CASCADE;"`
+}
+
+// Membership grants a user access to an organization with a role
+type Membership struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE;"`
+	OrganizationID uuid.UUID    `gorm:"type:uuid;not null;uniqueIndex:idx_organization_user"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_organization_user;index"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+
+	Role string `gorm:"size:16;not null"`
+}
+
+// Invitation asks the owner of an email address to join an organization
+type Invitation struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	Organization   Organization `gorm:"constraint:OnDelete:CASCADE;"`
+	OrganizationID uuid.UUID    `gorm:"type:uuid;not null;index"`
+
+	InvitedBy   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	InvitedByID uuid.UUID `gorm:"type:uuid;not null"`
+
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ExpiresAt  time.Time `gorm:"not null"`
+	AcceptedAt *time.Time
+
+	Email     string `gorm:"size:254;not null;index"`
+	Role      string `gorm:"size:16;not null"`
+	TokenHash string `gorm:"size:64;uniqueIndex;not null"`
+}
@@ -0,0 +1,17 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrphanedObject is a stored object whose rows have been deleted, waiting to be removed from its bucket
+type OrphanedObject struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+
+	Bucket    string `gorm:"size:63;not null"`
+	ObjectKey string `gorm:"size:1024;not null"`
+}
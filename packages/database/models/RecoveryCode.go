@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type RecoveryCode struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UsedAt    *time.Time
+
+	CodeHash string `gorm:"size:64;uniqueIndex;not null"`
+}
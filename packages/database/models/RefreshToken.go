@@ -0,0 +1,22 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RefreshToken is one token in the rotation chain of a token-endpoint session. Rotated tokens
+// are kept, marked with RotatedAt, for as long as the session lives so that presenting any of
+// them again is recognised as reuse.
+type RefreshToken struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	Session   Session   `gorm:"constraint:OnDelete:CASCADE;"`
+	SessionID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	RotatedAt *time.Time
+
+	TokenHash string `gorm:"size:64;uniqueIndex;not null"`
+}
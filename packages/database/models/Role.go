@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	PermissionAuditRead        = "audit:read"
+	PermissionLockoutsUnlock   = "lockouts:unlock"
+	PermissionRolesManage      = "roles:manage"
+	PermissionUsersImpersonate = "users:impersonate"
+)
+
+// Permissions lists every permission a role can be granted
+var Permissions = []string{
+	PermissionAuditRead,
+	PermissionLockoutsUnlock,
+	PermissionRolesManage,
+	PermissionUsersImpersonate,
+}
+
+// RoleAdmin is the name of the seeded role that holds every permission
+const RoleAdmin = "admin"
+
+// Role is a named set of permissions that can be granted to users
+type Role struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+	UpdatedAt time.Time `gorm:"autoUpdateTime"`
+
+	Name        string   `gorm:"size:64;uniqueIndex;not null"`
+	Description string   `gorm:"size:255"`
+	Permissions []string `gorm:"type:jsonb;serializer:json;not null"`
+}
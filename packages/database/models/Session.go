@@ -16,8 +16,21 @@ type Session struct {
 	UpdatedAt time.Time `gorm:"autoUpdateTime"`
 	ExpiresAt time.Time `gorm:"not null"`
 
-	Token string `gorm:"type:text;uniqueIndex;not null"`
+	// TokenHash is the digest of the session token; the token itself is never stored
+	TokenHash string `gorm:"type:text;uniqueIndex"`
+
+	// Token holds the plaintext token of sessions created before tokens were hashed.
+	// It is cleared as those sessions are converted and is never set on new sessions.
+	Token *string `gorm:"type:text;uniqueIndex"`
 
 	IPAddress *string `gorm:"type:text"`
 	UserAgent *string `gorm:"type:text"`
+
+	// AuthenticatedAt is when the user last proved who they are in this session, by signing in
+	// or re-authenticating with a passkey. It is never set on impersonated sessions.
+	AuthenticatedAt *time.Time
+
+	// ImpersonatorID is the admin acting as the user; impersonated sessions never slide
+	ImpersonatorID *uuid.UUID `gorm:"type:uuid;index"`
+	ReadOnly       bool       `gorm:"default:false"`
 }
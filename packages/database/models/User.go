@@ -4,6 +4,7 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 type User struct {
@@ -11,7 +12,10 @@ type User struct {
 
 	CreatedAt time.Time
 	UpdatedAt time.Time
-	DeletedAt time.Time
+	DeletedAt gorm.DeletedAt `gorm:"index"`
+
+	// DeletionScheduledAt is when the account will be purged; signing in clears it
+	DeletionScheduledAt *time.Time `gorm:"index"`
 
 	FirstName string `gorm:"not null"`
 	LastName  string `gorm:"not null"`
@@ -19,8 +23,16 @@ type User struct {
 	Email           string `gorm:"uniqueIndex;not null"`
 	IsEmailVerified bool   `gorm:"default:false"`
 
-	Phone           string `gorm:"uniqueIndex;not null"`
-	IsPhoneVerified bool   `gorm:"default:false"`
+	// Phone is nil for accounts created through an external identity provider
+	Phone           *string `gorm:"uniqueIndex"`
+	IsPhoneVerified bool    `gorm:"default:false"`
+
+	// Password is empty for passkey-only accounts
+	Password string
+
+	TOTPSecret       string `gorm:"type:text" json:"-"`
+	IsTOTPEnabled    bool   `gorm:"default:false"`
+	TOTPLastUsedStep int64  `gorm:"default:0"`
 
-	Password string `gorm:"not null"`
+	Roles []Role `gorm:"many2many:user_roles;constraint:OnDelete:CASCADE;"`
 }
@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	VerificationTokenPurposeEmailVerification = "email_verification"
+	VerificationTokenPurposePasswordReset     = "password_reset"
+	VerificationTokenPurposeMFAChallenge      = "mfa_challenge"
+	VerificationTokenPurposeEmailChange       = "email_change"
+	VerificationTokenPurposeMagicLink         = "magic_link"
+)
+
+type VerificationToken struct {
+	ID uuid.UUID `gorm:"type:uuid;default:uuid_generate_v4();primaryKey"`
+
+	User   User      `gorm:"constraint:OnDelete:CASCADE;"`
+	UserID uuid.UUID `gorm:"type:uuid;not null;index"`
+
+	CreatedAt time.Time  `gorm:"autoCreateTime"`
+	ExpiresAt time.Time  `gorm:"not null"`
+	UsedAt    *time.Time `gorm:"index"`
+
+	Purpose   string `gorm:"size:64;not null;index"`
+	TokenHash string `gorm:"size:64;uniqueIndex;not null"`
+
+	Attempts int `gorm:"not null;default:0"`
+	// RememberMe carries the sign-in option for MFA challenges and magic links
+	RememberMe bool `gorm:"default:false"`
+
+	// Email is the new address for email change tokens
+	Email string `gorm:"size:254"`
+}